@@ -1,249 +1,698 @@
 package api
 
 import (
-	"errors"
-	"log"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
 	_ "net/http"
+	"printfulapi/src/metrics"
 	"printfulapi/src/model"
 	"printfulapi/src/printful"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/mitchellh/mapstructure"
+	"github.com/gin-gonic/gin/binding"
 )
 
 type ApiRequest struct {
+	// Optional id echoed back in batch results
+	ID      interface{}            `json:"id"`
 	Action  string                 `json:"action" binding:"required"`
 	Version int                    `json:"version" binding:"required"`
 	Params  map[string]interface{} `json:"params"`
 }
 
-func ApiHandler(c *gin.Context) {
-	var request ApiRequest
-	var err error
+// Deadline of an action when the configuration doesn't set one
+const DEFAULT_ACTION_TIMEOUT = 60 * time.Second
 
-	if err = c.ShouldBindJSON(&request); err != nil {
-		log.Println(err)
-		jsonError(c, errors.New("bad request"))
+type Handler struct {
+	printful      *printful.Client
+	auth          *Authenticator
+	limiter       *Limiter
+	actionTimeout time.Duration
+	registry      *Registry
+	started       time.Time
+}
+
+type HandlerOption func(*Handler)
+
+// WithAuthenticator checks the API key and the scopes of every action, any caller is accepted otherwise
+func WithAuthenticator(auth *Authenticator) HandlerOption {
+	return func(h *Handler) {
+		h.auth = auth
+	}
+}
+
+// WithLimiter applies the inbound rate limits and quotas, callers are not limited otherwise
+func WithLimiter(limiter *Limiter) HandlerOption {
+	return func(h *Handler) {
+		h.limiter = limiter
+	}
+}
+
+// WithActionTimeout bounds each action, including every call it makes to Printful and to the databases
+func WithActionTimeout(timeout time.Duration) HandlerOption {
+	return func(h *Handler) {
+		h.actionTimeout = timeout
+	}
+}
+
+func NewHandler(client *printful.Client, opts ...HandlerOption) *Handler {
+	h := &Handler{
+		printful:      client,
+		actionTimeout: DEFAULT_ACTION_TIMEOUT,
+		registry:      defaultRegistry(),
+		started:       time.Now(),
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
+}
+
+// Registry returns the actions served by the handler, new versions of an action are registered there
+func (h *Handler) Registry() *Registry {
+	return h.registry
+}
+
+func (h *Handler) ApiHandler(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "unable to read the request body", "error", err)
+		jsonError(c, ValidationError{Message: "bad request"})
 		return
 	}
 
-	switch request.Action {
-	case "get-countries":
-		err = getCountries(c)
-	case "get-products":
-		err = getProducts(c)
-	case "get-product":
-		err = getProduct(c, request.Params)
-	case "get-variant":
-		err = getVariant(c, request.Params)
-	case "get-similar-variants":
-		err = getSimilarVariants(c, request.Params)
-	case "get-templates":
-		err = getTemplates(c, request.Params)
-	case "get-printfiles":
-		err = getPrintfiles(c, request.Params)
-	case "create-sync-product":
-		err = createSyncProduct(c, request.Params)
-	case "get-sync-product":
-		err = getSyncProduct(c, request.Params)
-	case "calculate-shipping-rates":
-		err = calculateShippingRates(c, request.Params)
-	case "calculate-tax-rate":
-		err = calculateTaxRate(c, request.Params)
-	case "create-order":
-		err = createOrder(c, request.Params)
-	default:
-		jsonError(c, NotFoundError{})
+	if isBatch(body) {
+		h.batchHandler(c, body)
 		return
 	}
 
+	request, err := parseApiRequest(body)
+	if err != nil {
+		slog.InfoContext(c.Request.Context(), "invalid request", "error", err)
+		jsonError(c, ValidationError{Message: "bad request"})
+		return
+	}
+
+	result, err := h.runAction(c, request)
 	if err != nil {
 		jsonError(c, err)
+		return
 	}
+
+	jsonSuccess(c, result)
 }
 
-func getCountries(c *gin.Context) error {
-	countries, err := printful.GetCountries()
+func parseApiRequest(body []byte) (*ApiRequest, error) {
+	request := ApiRequest{}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, err
+	}
 
+	if err := binding.Validator.ValidateStruct(&request); err != nil {
+		return nil, err
+	}
+
+	return &request, nil
+}
+
+func (h *Handler) runAction(c *gin.Context, request *ApiRequest) (result interface{}, err error) {
+	start := time.Now()
+	name := metrics.UNKNOWN_ACTION
+	defer func() {
+		observeAction(name, start, err)
+	}()
+
+	action, err := h.registry.Lookup(request.Action, request.Version)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	name = request.Action
+
+	if h.auth != nil {
+		if err = authorize(c, action.Scope); err != nil {
+			return nil, err
+		}
 	}
 
-	jsonSuccess(c, countries)
+	if h.limiter != nil {
+		if err = h.limiter.Allow(clientID(c), actionClass(action.Scope)); err != nil {
+			return nil, err
+		}
+	}
+
+	// The action stops when the client goes away or when it takes too long
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.actionTimeout)
+	defer cancel()
+
+	result, err = action.Run(h, ctx, request.Params)
+	if err != nil && ctx.Err() != nil {
+		slog.WarnContext(ctx, "action timed out", "action", request.Action, "error", err)
+		return nil, TimeoutError{Message: "action " + request.Action + " did not complete in time"}
+	}
 
-	return nil
+	return result, err
 }
 
-func getProducts(c *gin.Context) error {
-	products, err := printful.GetProducts()
+func observeAction(name string, start time.Time, err error) {
+	metrics.ActionRequests.WithLabelValues(name).Inc()
+	metrics.ActionDuration.WithLabelValues(name).Observe(metrics.Since(start))
+	if err != nil {
+		metrics.ActionErrors.WithLabelValues(name, toApiError(err).Code()).Inc()
+	}
+}
+
+func (h *Handler) getApiVersions(ctx context.Context) (interface{}, error) {
+	return h.registry.Versions(), nil
+}
+
+func (h *Handler) getCountries(ctx context.Context) (interface{}, error) {
+	countries, err := h.printful.GetCountries(ctx)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	jsonSuccess(c, products)
+	return countries, nil
+}
+
+func (h *Handler) getProducts(ctx context.Context) (interface{}, error) {
+	products, err := h.printful.GetProducts(ctx)
+
+	if err != nil {
+		return nil, err
+	}
 
-	return nil
+	return products, nil
 }
 
-func getProduct(c *gin.Context, params map[string]interface{}) error {
-	product, err, _ := printful.GetProduct(int(params["product_id"].(float64)))
-	log.Println(params)
+func (h *Handler) getProduct(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	getProductRequest := model.GetProductRequest{}
+	err := decodeParams(params, &getProductRequest)
+	if err != nil {
+		return nil, err
+	}
 
+	product, err, _ := h.printful.GetProduct(ctx, getProductRequest.ProductID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	jsonSuccess(c, product)
+	return product, nil
+}
 
-	return nil
+func (h *Handler) getVariant(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	getVariantRequest := model.GetVariantRequest{}
+	err := decodeParams(params, &getVariantRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	variant, err, _ := h.printful.GetVariant(ctx, getVariantRequest.VariantID)
+	if err != nil {
+		return nil, err
+	}
+
+	return variant, nil
 }
 
-func getVariant(c *gin.Context, params map[string]interface{}) error {
-	variant, err, _ := printful.GetVariant(int(params["variant_id"].(float64)))
-	log.Println(params)
+func (h *Handler) getSimilarVariants(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	getSimilarVariantsRequest := model.GetSimilarVariantsRequest{}
+	err := decodeParams(params, &getSimilarVariantsRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	variantIds, err := h.printful.GetSimilarVariants(ctx, getSimilarVariantsRequest.VariantID, getSimilarVariantsRequest.Placement)
+	if err != nil {
+		return nil, err
+	}
+
+	return variantIds, nil
+}
 
+func (h *Handler) getTemplates(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	getTemplatesRequest := model.GetTemplatesRequest{}
+	err := decodeParams(params, &getTemplatesRequest)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	//log.Println("variant", variant)
-	jsonSuccess(c, variant)
+	templates, err := h.printful.GetTemplates(ctx, getTemplatesRequest.ProductID)
+	if err != nil {
+		return nil, err
+	}
 
-	return nil
+	return templates, nil
 }
 
-func getSimilarVariants(c *gin.Context, params map[string]interface{}) error {
+func (h *Handler) getPrintfiles(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	getPrintfilesRequest := model.GetPrintfilesRequest{}
+	err := decodeParams(params, &getPrintfilesRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	printfiles, err := h.printful.GetPrintfiles(ctx, getPrintfilesRequest.ProductID)
+	if err != nil {
+		return nil, err
+	}
 
-	log.Println("getSimilarVariants", params)
+	return printfiles, nil
+}
 
-	p, placementOk := params["placement"]
-	var placement string
-	if !placementOk {
-		placement = "default"
-	} else {
-		placement = p.(string)
+func (h *Handler) uploadImage(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	uploadImageRequest := model.UploadImageRequest{}
+	err := decodeParams(params, &uploadImageRequest)
+	if err != nil {
+		return nil, err
 	}
 
-	variantIds, err := printful.GetSimilarVariants(int(params["variant_id"].(float64)), placement)
-	log.Println(variantIds, err)
+	design, err := h.printful.UploadImage(ctx, uploadImageRequest)
+	if err != nil {
+		return nil, err
+	}
 
-	jsonSuccess(c, variantIds)
+	return design, nil
+}
+
+func (h *Handler) validateArtwork(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	validateArtworkRequest := model.ValidateArtworkRequest{}
+	err := decodeParams(params, &validateArtworkRequest)
+	if err != nil {
+		return nil, err
+	}
 
-	return nil
+	validation, err := h.printful.ValidateArtwork(ctx, validateArtworkRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	return validation, nil
 }
 
-func getTemplates(c *gin.Context, params map[string]interface{}) error {
-	templates, err := printful.GetTemplates(int(params["product_id"].(float64)))
-	log.Println(params)
+func (h *Handler) createSyncProduct(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	createSyncProductRequest := model.CreateSyncProductDatas{}
+	err := decodeParams(params, &createSyncProductRequest)
+	if err != nil {
+		return nil, err
+	}
 
+	syncProduct, err := h.printful.CreateSyncProduct(ctx, createSyncProductRequest)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	jsonSuccess(c, templates)
+	return syncProduct, nil
+}
 
-	return nil
+func (h *Handler) getSyncProduct(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	syncProductReference := model.SyncProductReference{}
+	err := decodeParams(params, &syncProductReference)
+	if err != nil {
+		return nil, err
+	}
+
+	product, err := h.printful.GetSyncProduct(ctx, syncProductReference)
+	if err != nil {
+		return nil, err
+	}
+
+	return product, nil
 }
 
-func getPrintfiles(c *gin.Context, params map[string]interface{}) error {
-	templates, err := printful.GetPrintfiles(int(params["product_id"].(float64)))
-	log.Println(params)
+func (h *Handler) listSyncProducts(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	listSyncProductsRequest := model.ListSyncProductsRequest{}
+	err := decodeParams(params, &listSyncProductsRequest)
+	if err != nil {
+		return nil, err
+	}
 
+	products, paging, err := h.printful.ListSyncProducts(ctx, listSyncProductsRequest)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	jsonSuccess(c, templates)
+	return gin.H{
+		"sync_products": products,
+		"paging":        paging,
+	}, nil
+}
+
+func (h *Handler) modifySyncProduct(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	modifySyncProductRequest := model.ModifySyncProductRequest{}
+	err := decodeParams(params, &modifySyncProductRequest)
+	if err != nil {
+		return nil, err
+	}
 
-	return nil
+	product, err := h.printful.ModifySyncProduct(ctx, modifySyncProductRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	return product, nil
 }
 
-func createSyncProduct(c *gin.Context, params map[string]interface{}) error {
-	createSyncProductRequest := model.CreateSyncProductDatas{}
-	err := mapstructure.Decode(params, &createSyncProductRequest)
+func (h *Handler) deleteSyncProduct(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	syncProductReference := model.SyncProductReference{}
+	err := decodeParams(params, &syncProductReference)
+	if err != nil {
+		return nil, err
+	}
+
+	product, err := h.printful.DeleteSyncProduct(ctx, syncProductReference)
 	if err != nil {
-		log.Println(err)
-		return errors.New("Error while decoding params")
+		return nil, err
 	}
 
-	syncProduct, err := printful.CreateSyncProduct(createSyncProductRequest)
-	log.Println(syncProduct, err)
+	return product, nil
+}
+
+func (h *Handler) getSyncVariant(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	syncVariantReference := model.SyncVariantReference{}
+	err := decodeParams(params, &syncVariantReference)
+	if err != nil {
+		return nil, err
+	}
 
-	jsonSuccess(c, syncProduct)
+	variant, err := h.printful.GetSyncVariant(ctx, syncVariantReference)
+	if err != nil {
+		return nil, err
+	}
 
-	return nil
+	return variant, nil
 }
 
-func getSyncProduct(c *gin.Context, params map[string]interface{}) error {
-	product, err := printful.GetSyncProduct(int64(params["sync_product_id"].(float64)))
-	log.Println(product, params)
+func (h *Handler) createSyncVariant(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	createSyncVariantRequest := model.CreateSyncVariantRequest{}
+	err := decodeParams(params, &createSyncVariantRequest)
+	if err != nil {
+		return nil, err
+	}
 
+	variant, err := h.printful.CreateSyncVariant(ctx, createSyncVariantRequest)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	jsonSuccess(c, product)
+	return variant, nil
+}
+
+func (h *Handler) modifySyncVariant(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	modifySyncVariantRequest := model.ModifySyncVariantRequest{}
+	err := decodeParams(params, &modifySyncVariantRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	variant, err := h.printful.ModifySyncVariant(ctx, modifySyncVariantRequest)
+	if err != nil {
+		return nil, err
+	}
 
-	return nil
+	return variant, nil
 }
 
-func calculateShippingRates(c *gin.Context, params map[string]interface{}) error {
-	calculateShippingRatesRequest := model.CalculateShippingRates{}
-	err := mapstructure.Decode(params, &calculateShippingRatesRequest)
+func (h *Handler) deleteSyncVariant(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	syncVariantReference := model.SyncVariantReference{}
+	err := decodeParams(params, &syncVariantReference)
+	if err != nil {
+		return nil, err
+	}
+
+	err = h.printful.DeleteSyncVariant(ctx, syncVariantReference)
 	if err != nil {
-		log.Println(err)
-		return errors.New("Error while decoding params")
+		return nil, err
 	}
 
-	shippingRates, err := printful.CalculateShippingRates(calculateShippingRatesRequest)
-	log.Println(shippingRates, err)
+	return nil, nil
+}
+
+func (h *Handler) calculateShippingRates(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	calculateShippingRatesRequest := model.CalculateShippingRates{}
+	err := decodeParams(params, &calculateShippingRatesRequest)
 	if err != nil {
-		log.Println(err)
-		return errors.New("Error while calculating shipping rates")
+		return nil, err
 	}
 
-	jsonSuccess(c, shippingRates)
+	shippingRates, err := h.printful.CalculateShippingRates(ctx, calculateShippingRatesRequest)
+	if err != nil {
+		return nil, fmt.Errorf("Error while calculating shipping rates: <%w>", err)
+	}
 
-	return nil
+	return shippingRates, nil
 }
 
-func calculateTaxRate(c *gin.Context, params map[string]interface{}) error {
+func (h *Handler) calculateTaxRate(ctx context.Context, params map[string]interface{}) (interface{}, error) {
 	calculateTaxRateRequest := model.CalculateTaxRate{}
-	err := mapstructure.Decode(params, &calculateTaxRateRequest)
+	err := decodeParams(params, &calculateTaxRateRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	shippingRates, err := h.printful.CalculateTaxRate(ctx, calculateTaxRateRequest)
 	if err != nil {
-		log.Println(err)
-		return errors.New("Error while decoding params")
+		return nil, fmt.Errorf("Error while calculating tax rate: <%w>", err)
 	}
 
-	shippingRates, err := printful.CalculateTaxRate(calculateTaxRateRequest)
-	log.Println(shippingRates, err)
+	return shippingRates, nil
+}
+
+func (h *Handler) createOrder(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	createOrderRequest := model.CreateOrderRequest{}
+	err := decodeParams(params, &createOrderRequest)
 	if err != nil {
-		log.Println(err)
-		return errors.New("Error while calculating shipping rates")
+		return nil, err
 	}
 
-	jsonSuccess(c, shippingRates)
+	slog.DebugContext(ctx, "creating order", "order", createOrderRequest.Order)
 
-	return nil
+	order, err := h.printful.CreateOrder(ctx, createOrderRequest)
+	if err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "order created", "order_id", order.ID, "external_id", order.ExternalID)
+
+	return order, nil
 }
 
-func createOrder(c *gin.Context, params map[string]interface{}) error {
-	log.Println("<<<<<<<<<<<<<<<<<<<<<<", params)
+func (h *Handler) getOrder(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	orderReference := model.OrderReference{}
+	err := decodeParams(params, &orderReference)
+	if err != nil {
+		return nil, err
+	}
 
-	createOrderRequest := model.CreateOrderRequest{}
-	err := mapstructure.Decode(params, &createOrderRequest)
+	order, err := h.printful.GetOrder(ctx, orderReference)
 	if err != nil {
-		log.Println(err)
-		return errors.New("Error while decoding params")
+		return nil, err
 	}
 
-	log.Println("=====================", createOrderRequest)
+	return order, nil
+}
 
-	order, err := printful.CreateOrder(createOrderRequest)
-	log.Println(order, err)
+func (h *Handler) listOrders(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	listOrdersRequest := model.ListOrdersRequest{}
+	err := decodeParams(params, &listOrdersRequest)
+	if err != nil {
+		return nil, err
+	}
 
-	jsonSuccess(c, order)
+	orders, paging, err := h.printful.ListOrders(ctx, listOrdersRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{
+		"orders": orders,
+		"paging": paging,
+	}, nil
+}
+
+func (h *Handler) updateOrder(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	updateOrderRequest := model.UpdateOrderRequest{}
+	err := decodeParams(params, &updateOrderRequest)
+	if err != nil {
+		return nil, err
+	}
+	if order, ok := params["order"].(map[string]interface{}); ok {
+		for field := range order {
+			updateOrderRequest.Fields = append(updateOrderRequest.Fields, field)
+		}
+	}
+
+	order, err := h.printful.UpdateOrder(ctx, updateOrderRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+func (h *Handler) confirmOrder(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	orderReference := model.OrderReference{}
+	err := decodeParams(params, &orderReference)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := h.printful.ConfirmOrder(ctx, orderReference)
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+func (h *Handler) cancelOrder(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	orderReference := model.OrderReference{}
+	err := decodeParams(params, &orderReference)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := h.printful.CancelOrder(ctx, orderReference)
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+func (h *Handler) estimateOrderCosts(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	estimateOrderCostsRequest := model.EstimateOrderCostsRequest{}
+	err := decodeParams(params, &estimateOrderCostsRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	costs, err := h.printful.EstimateOrderCosts(ctx, estimateOrderCostsRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	return costs, nil
+}
+
+func (h *Handler) getWebhooks(ctx context.Context) (interface{}, error) {
+	webhooks, err := h.printful.GetWebhooks(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+func (h *Handler) setWebhooks(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	setWebhooksRequest := model.SetWebhooksRequest{}
+	err := decodeParams(params, &setWebhooksRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks, err := h.printful.SetWebhooks(ctx, setWebhooksRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+func (h *Handler) disableWebhooks(ctx context.Context) (interface{}, error) {
+	webhooks, err := h.printful.DisableWebhooks(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+func (h *Handler) createMockupTask(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	createMockupTaskRequest := model.CreateMockupTask{}
+	err := decodeParams(params, &createMockupTaskRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	task, err := h.printful.CreateMockupTask(ctx, createMockupTaskRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	return task, nil
+}
+
+func (h *Handler) getMockupTask(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	getMockupTaskRequest := model.GetMockupTask{}
+	err := decodeParams(params, &getMockupTaskRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	task, err := h.printful.GetMockupTask(ctx, getMockupTaskRequest.TaskKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return task, nil
+}
+
+func (h *Handler) createApiKey(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	if h.auth == nil {
+		return nil, ValidationError{Message: "API keys are not enabled"}
+	}
+
+	createApiKeyRequest := model.CreateApiKeyRequest{}
+	err := decodeParams(params, &createApiKeyRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.auth.createApiKey(ctx, createApiKeyRequest)
+}
+
+func (h *Handler) revokeApiKey(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	if h.auth == nil {
+		return nil, ValidationError{Message: "API keys are not enabled"}
+	}
+
+	revokeApiKeyRequest := model.RevokeApiKeyRequest{}
+	err := decodeParams(params, &revokeApiKeyRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	err = h.auth.revokeApiKey(ctx, revokeApiKeyRequest.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (h *Handler) listApiKeys(ctx context.Context) (interface{}, error) {
+	if h.auth == nil {
+		return nil, ValidationError{Message: "API keys are not enabled"}
+	}
+
+	return h.auth.listApiKeys(ctx)
+}
+
+func (h *Handler) getUsage(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	if h.limiter == nil {
+		return nil, ValidationError{Message: "rate limiting is not enabled"}
+	}
+
+	getUsageRequest := model.GetUsageRequest{}
+	err := decodeParams(params, &getUsageRequest)
+	if err != nil {
+		return nil, err
+	}
 
-	return nil
+	return h.limiter.Usage(getUsageRequest.Client), nil
 }
@@ -0,0 +1,1526 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"printfulapi/src/config"
+	"printfulapi/src/metrics"
+	"printfulapi/src/model"
+	"printfulapi/src/printful"
+	"printfulapi/src/printful/printfultest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/baldurstod/printful-api-model/schemas"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const testAccessToken = "test-token"
+
+type apiResponse struct {
+	Status  int             `json:"-"`
+	Success bool            `json:"success"`
+	Result  json.RawMessage `json:"result"`
+	Error   string          `json:"error"`
+	Code    string          `json:"code"`
+	// Seconds sent back with the rate limit errors
+	RetryAfter int `json:"retry_after"`
+	Printful   struct {
+		Status int    `json:"status"`
+		Code   int    `json:"code"`
+		Reason string `json:"reason"`
+	} `json:"printful"`
+	// Set when a change applied variant by variant fails part way
+	UpdatedSyncVariantIDs []int64 `json:"updated_sync_variant_ids"`
+}
+
+type testEnv struct {
+	printful *printfultest.Server
+	images   *memoryImages
+	handler  *Handler
+	engine   *gin.Engine
+	// Headers sent with every call
+	headers http.Header
+}
+
+type memoryImages struct {
+	mutex sync.Mutex
+	files map[string][]byte
+}
+
+func (m *memoryImages) UploadFile(ctx context.Context, filename string, content []byte) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.files[filename] = content
+	return nil
+}
+
+func (m *memoryImages) OpenFile(ctx context.Context, filename string) (io.ReadCloser, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	content, ok := m.files[filename]
+	if !ok {
+		return nil, printful.NotFoundError{Message: "file not found"}
+	}
+	return io.NopCloser(bytes.NewReader(content)), nil
+}
+
+func newTestEnv(t *testing.T, opts ...printful.Option) *testEnv {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	server := printfultest.NewServer()
+	server.AccessToken = testAccessToken
+	t.Cleanup(server.Close)
+
+	images := &memoryImages{files: make(map[string][]byte)}
+	opts = append([]printful.Option{printful.WithImageStore(images), printful.WithPrivateImageHosts()}, opts...)
+	opts = append(opts,
+		printful.WithBaseURL(server.URL),
+		printful.WithAccessToken(testAccessToken),
+	)
+	handler := NewHandler(printful.NewClient(opts...))
+
+	engine := gin.New()
+	engine.POST("/api", handler.ApiHandler)
+
+	return &testEnv{printful: server, images: images, handler: handler, engine: engine}
+}
+
+// withAuth requires the API keys of auth on /api
+func (env *testEnv) withAuth(auth *Authenticator) {
+	env.handler.auth = auth
+	env.engine = gin.New()
+	env.engine.POST("/api", auth.Middleware(), env.handler.ApiHandler)
+	env.headers = http.Header{}
+}
+
+type memoryKeys struct {
+	mutex   sync.Mutex
+	keys    []model.ApiKey
+	listErr error
+}
+
+func (m *memoryKeys) InsertApiKey(ctx context.Context, key *model.ApiKey) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.keys = append(m.keys, *key)
+	return nil
+}
+
+func (m *memoryKeys) FindApiKey(ctx context.Context, hash string) (*model.ApiKey, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, k := range m.keys {
+		if k.Hash == hash {
+			return &k, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memoryKeys) ListApiKeys(ctx context.Context) ([]model.ApiKey, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.listErr != nil {
+		return nil, m.listErr
+	}
+	return append([]model.ApiKey{}, m.keys...), nil
+}
+
+func (m *memoryKeys) RevokeApiKey(ctx context.Context, id string) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for i := range m.keys {
+		if m.keys[i].ID == id {
+			m.keys[i].Revoked = true
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (env *testEnv) call(t *testing.T, action string, params map[string]interface{}) apiResponse {
+	t.Helper()
+
+	return env.callVersion(t, action, 1, params)
+}
+
+func (env *testEnv) callVersion(t *testing.T, action string, version int, params map[string]interface{}) apiResponse {
+	t.Helper()
+
+	body, err := json.Marshal(map[string]interface{}{
+		"action":  action,
+		"version": version,
+		"params":  params,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("POST", "/api", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for name, values := range env.headers {
+		req.Header[name] = values
+	}
+	w := httptest.NewRecorder()
+	env.engine.ServeHTTP(w, req)
+
+	response := apiResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("%s: invalid response %q: %v", action, w.Body.String(), err)
+	}
+	response.Status = w.Code
+
+	return response
+}
+
+func (env *testEnv) mustSucceed(t *testing.T, action string, params map[string]interface{}, result interface{}) {
+	t.Helper()
+
+	response := env.call(t, action, params)
+	if !response.Success {
+		t.Fatalf("%s failed: %s", action, response.Error)
+	}
+
+	if result != nil {
+		if err := json.Unmarshal(response.Result, result); err != nil {
+			t.Fatalf("%s: unable to decode result %s: %v", action, response.Result, err)
+		}
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	env := newTestEnv(t)
+
+	countries := []struct {
+		Code string `json:"code"`
+	}{}
+	env.mustSucceed(t, "get-countries", nil, &countries)
+	if len(countries) != 2 || countries[0].Code != "US" {
+		t.Errorf("unexpected countries %+v", countries)
+	}
+
+	products := []struct {
+		ID int `json:"id"`
+	}{}
+	env.mustSucceed(t, "get-products", nil, &products)
+	if len(products) != 2 {
+		t.Errorf("expected 2 products, got %d", len(products))
+	}
+
+	product := struct {
+		Product struct {
+			ID int `json:"id"`
+		} `json:"product"`
+		Variants []struct {
+			ID int `json:"id"`
+		} `json:"variants"`
+	}{}
+	env.mustSucceed(t, "get-product", map[string]interface{}{"product_id": 71}, &product)
+	if product.Product.ID != 71 || len(product.Variants) != 3 {
+		t.Errorf("unexpected product %+v", product)
+	}
+
+	variant := struct {
+		Variant struct {
+			ID   int    `json:"id"`
+			Size string `json:"size"`
+		} `json:"variant"`
+	}{}
+	env.mustSucceed(t, "get-variant", map[string]interface{}{"variant_id": 4012}, &variant)
+	if variant.Variant.ID != 4012 || variant.Variant.Size != "M" {
+		t.Errorf("unexpected variant %+v", variant)
+	}
+}
+
+func TestMockupGenerator(t *testing.T) {
+	env := newTestEnv(t)
+
+	templates := struct {
+		MinDPI    int `json:"min_dpi"`
+		Templates []struct {
+			TemplateID int `json:"template_id"`
+		} `json:"templates"`
+	}{}
+	env.mustSucceed(t, "get-templates", map[string]interface{}{"product_id": 71}, &templates)
+	if templates.MinDPI != 150 || len(templates.Templates) != 2 {
+		t.Errorf("unexpected templates %+v", templates)
+	}
+
+	printfiles := struct {
+		Printfiles []struct {
+			Width int `json:"width"`
+		} `json:"printfiles"`
+	}{}
+	env.mustSucceed(t, "get-printfiles", map[string]interface{}{"product_id": 71}, &printfiles)
+	if len(printfiles.Printfiles) != 2 {
+		t.Errorf("unexpected printfiles %+v", printfiles)
+	}
+
+	similar := []int{}
+	env.mustSucceed(t, "get-similar-variants", map[string]interface{}{"variant_id": 4011, "placement": "front"}, &similar)
+	if len(similar) != 2 || similar[0] != 4011 || similar[1] != 4012 {
+		t.Errorf("unexpected similar variants %v", similar)
+	}
+
+	// placement defaults to the default placement, which product 71 names front: only the variant itself matches
+	env.mustSucceed(t, "get-similar-variants", map[string]interface{}{"variant_id": 4011}, &similar)
+	if len(similar) != 1 || similar[0] != 4011 {
+		t.Errorf("unexpected similar variants %v", similar)
+	}
+}
+
+func TestParamsValidation(t *testing.T) {
+	env := newTestEnv(t)
+
+	type field struct {
+		Field   string `json:"field"`
+		Message string `json:"message"`
+	}
+	fields := func(action string, params map[string]interface{}) []field {
+		t.Helper()
+
+		w := httptest.NewRecorder()
+		body, _ := json.Marshal(map[string]interface{}{"action": action, "version": 1, "params": params})
+		env.engine.ServeHTTP(w, httptest.NewRequest("POST", "/api", bytes.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s %v: expected 400, got %d %s", action, params, w.Code, w.Body.String())
+		}
+
+		response := struct {
+			Code   string  `json:"code"`
+			Fields []field `json:"fields"`
+		}{}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		if response.Code != "validation_error" {
+			t.Errorf("unexpected code %s", response.Code)
+		}
+		return response.Fields
+	}
+
+	for _, test := range []struct {
+		action string
+		params map[string]interface{}
+		fields []field
+	}{
+		{"get-product", nil, []field{{"product_id", "is required"}}},
+		{"get-templates", map[string]interface{}{"product_id": -1}, []field{{"product_id", "must be at least 1"}}},
+		{"get-order", map[string]interface{}{}, []field{{"order_id", "or external_id is required"}}},
+		{"create-order", map[string]interface{}{"order": map[string]interface{}{"items": []interface{}{}}}, []field{{"order.external_id", "is required"}}},
+		{"list-orders", map[string]interface{}{"status": "lost", "limit": 500}, []field{
+			{"status", "must be one of draft pending failed canceled inprocess onhold partial fulfilled archived"},
+			{"limit", "must be at most 100"},
+		}},
+		{"set-webhooks", map[string]interface{}{"url": "https://example.com/hook", "types": []interface{}{"package_shipped", "package_lost"}}, []field{
+			{"types[1]", "must be one of package_shipped package_returned order_failed order_canceled product_synced stock_updated order_put_hold"},
+		}},
+		{"create-sync-product", map[string]interface{}{"product_id": 71, "variants": []interface{}{map[string]interface{}{"retail_price": -1}}}, []field{
+			{"variants[0].variant_id", "is required"},
+			{"variants[0].retail_price", "must be at least 0"},
+		}},
+	} {
+		got := fields(test.action, test.params)
+		if len(got) != len(test.fields) {
+			t.Errorf("%s %v: expected fields %v, got %v", test.action, test.params, test.fields, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.fields[i] {
+				t.Errorf("%s %v: expected field %v, got %v", test.action, test.params, test.fields[i], got[i])
+			}
+		}
+	}
+
+	got := fields("get-variant", map[string]interface{}{"variant_id": "abc"})
+	if len(got) != 1 || got[0].Field != "variant_id" || !strings.Contains(got[0].Message, "expected type 'int'") {
+		t.Errorf("a string id should be reported, got %v", got)
+	}
+}
+
+func TestShippingAndTax(t *testing.T) {
+	env := newTestEnv(t)
+
+	rates := []struct {
+		ID   string `json:"id"`
+		Rate string `json:"rate"`
+	}{}
+	env.mustSucceed(t, "calculate-shipping-rates", map[string]interface{}{
+		"recipient": map[string]interface{}{"country_code": "US", "state_code": "CA", "zip": "91311"},
+		"items":     []interface{}{map[string]interface{}{"variant_id": "4012", "quantity": 1}},
+	}, &rates)
+	if len(rates) != 2 || rates[0].ID != "STANDARD" {
+		t.Errorf("unexpected shipping rates %+v", rates)
+	}
+
+	tax := struct {
+		Required bool    `json:"required"`
+		Rate     float64 `json:"rate"`
+	}{}
+	env.mustSucceed(t, "calculate-tax-rate", map[string]interface{}{
+		"recipient": map[string]interface{}{"country_code": "US", "state_code": "CA", "city": "Chatsworth", "zip": "91311"},
+	}, &tax)
+	if !tax.Required || tax.Rate != 0.0725 {
+		t.Errorf("unexpected tax rate %+v", tax)
+	}
+}
+
+func TestCreateOrder(t *testing.T) {
+	env := newTestEnv(t)
+
+	order := struct {
+		ID         int64  `json:"id"`
+		ExternalID string `json:"external_id"`
+		Status     string `json:"status"`
+	}{}
+	env.mustSucceed(t, "create-order", map[string]interface{}{
+		"order": map[string]interface{}{
+			"external_id": "order-1",
+			"recipient":   map[string]interface{}{"name": "John Smith", "address1": "19749 Dearborn St", "city": "Chatsworth", "country_code": "US", "state_code": "CA", "zip": "91311"},
+			"items":       []interface{}{map[string]interface{}{"variant_id": 4012, "quantity": 2}},
+		},
+	}, &order)
+	if order.ID == 0 || order.ExternalID != "order-1" || order.Status != "draft" {
+		t.Errorf("unexpected order %+v", order)
+	}
+}
+
+func TestOrderLifecycle(t *testing.T) {
+	env := newTestEnv(t)
+
+	type order struct {
+		ID         int64  `json:"id"`
+		ExternalID string `json:"external_id"`
+		Status     string `json:"status"`
+		Shipping   string `json:"shipping"`
+		Recipient  struct {
+			Name     string `json:"name"`
+			Address1 string `json:"address1"`
+		} `json:"recipient"`
+		Items []struct {
+			VariantID int `json:"variant_id"`
+		} `json:"items"`
+	}
+
+	recipient := map[string]interface{}{"name": "John Smith", "address1": "19749 Dearborn St", "city": "Chatsworth", "country_code": "US", "state_code": "CA", "zip": "91311"}
+	items := []interface{}{map[string]interface{}{"variant_id": 4012, "quantity": 2}}
+
+	costs := struct {
+		Costs struct {
+			Subtotal float64 `json:"subtotal"`
+			Total    float64 `json:"total"`
+		} `json:"costs"`
+	}{}
+	env.mustSucceed(t, "estimate-order-costs", map[string]interface{}{
+		"order": map[string]interface{}{"recipient": recipient, "items": items},
+	}, &costs)
+	if costs.Costs.Subtotal != 18.5 || costs.Costs.Total <= costs.Costs.Subtotal {
+		t.Errorf("unexpected costs %+v", costs)
+	}
+
+	// The second external id must be escaped in the paths sent to Printful
+	for _, externalID := range []string{"order-1", "orders/2?draft#b"} {
+		env.mustSucceed(t, "create-order", map[string]interface{}{
+			"order": map[string]interface{}{"external_id": externalID, "recipient": recipient, "items": items},
+		}, nil)
+	}
+
+	created := order{}
+	env.mustSucceed(t, "get-order", map[string]interface{}{"external_id": "order-1"}, &created)
+	if created.ExternalID != "order-1" || created.Status != "draft" {
+		t.Fatalf("unexpected order %+v", created)
+	}
+
+	updated := order{}
+	env.mustSucceed(t, "update-order", map[string]interface{}{
+		"order_id": created.ID,
+		"order":    map[string]interface{}{"shipping": "EXPRESS"},
+	}, &updated)
+	if updated.Shipping != "EXPRESS" || updated.Status != "draft" {
+		t.Errorf("unexpected updated order %+v", updated)
+	}
+	if updated.ExternalID != "order-1" || updated.Recipient.Name != "John Smith" || updated.Recipient.Address1 == "" || len(updated.Items) != 1 {
+		t.Errorf("the fields left out of the update should be kept, got %+v", updated)
+	}
+
+	confirmed := order{}
+	env.mustSucceed(t, "confirm-order", map[string]interface{}{"order_id": created.ID}, &confirmed)
+	if confirmed.Status != "pending" {
+		t.Errorf("unexpected confirmed order %+v", confirmed)
+	}
+
+	canceled := order{}
+	env.mustSucceed(t, "cancel-order", map[string]interface{}{"external_id": "orders/2?draft#b"}, &canceled)
+	if canceled.Status != "canceled" || canceled.ExternalID != "orders/2?draft#b" {
+		t.Errorf("unexpected canceled order %+v", canceled)
+	}
+
+	list := struct {
+		Orders []order `json:"orders"`
+		Paging struct {
+			Total int `json:"total"`
+		} `json:"paging"`
+	}{}
+	env.mustSucceed(t, "list-orders", map[string]interface{}{"status": "pending", "limit": 10}, &list)
+	if list.Paging.Total != 1 || len(list.Orders) != 1 || list.Orders[0].ID != created.ID {
+		t.Errorf("unexpected order list %+v", list)
+	}
+
+	response := env.call(t, "confirm-order", map[string]interface{}{"order_id": created.ID})
+	if response.Success {
+		t.Error("confirming a pending order should fail")
+	}
+}
+
+func TestCreateSyncProductPlacements(t *testing.T) {
+	env := newTestEnv(t)
+
+	response := env.call(t, "create-sync-product", map[string]interface{}{
+		"product_id": 71,
+		"name":       "Shirt",
+		"variants":   []interface{}{map[string]interface{}{"variant_id": 4011, "retail_price": 19}},
+		"files": []interface{}{
+			map[string]interface{}{"type": "front", "image": "data:image/png;base64,AAAA"},
+			map[string]interface{}{"type": "sleeve_left", "image": "data:image/png;base64,AAAA"},
+			map[string]interface{}{"type": "back", "position": map[string]interface{}{"area_width": 1800}},
+		},
+	})
+	if response.Success {
+		t.Fatal("invalid placements should be rejected")
+	}
+
+	for _, problem := range []string{
+		"placement sleeve_left is not available for variant 4011",
+		"placement back has no image",
+		"placement back has an invalid position",
+	} {
+		if !strings.Contains(response.Error, problem) {
+			t.Errorf("error %q should mention %q", response.Error, problem)
+		}
+	}
+
+	for _, request := range env.printful.Requests() {
+		if request == "POST /store/products" {
+			t.Error("nothing should be submitted to printful")
+		}
+	}
+}
+
+// newTestImage returns a diagonal red line drawn over a background
+func newTestImage(width int, height int, background color.Color) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+	for x := 0; x < width; x++ {
+		img.Set(x, x%height, color.RGBA{R: 255, A: 255})
+	}
+
+	return img
+}
+
+func encodeTestImage(t *testing.T, img image.Image, encode func(io.Writer, image.Image) error) []byte {
+	t.Helper()
+
+	buf := bytes.Buffer{}
+	if err := encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDesignInputs(t *testing.T) {
+	env := newTestEnv(t, printful.WithConfig(config.Printful{ImagesURL: "https://example.com/images/"}))
+
+	img := newTestImage(300, 100, color.Transparent)
+	jpegImage := encodeTestImage(t, img, func(w io.Writer, img image.Image) error { return jpeg.Encode(w, img, nil) })
+	gifImage := encodeTestImage(t, img, func(w io.Writer, img image.Image) error { return gif.Encode(w, img, nil) })
+
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/design.jpg" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(jpegImage)
+	}))
+	t.Cleanup(remote.Close)
+
+	uploaded := model.Design{}
+	env.mustSucceed(t, "upload-image", map[string]interface{}{
+		"image": "data:image/gif;base64," + base64.StdEncoding.EncodeToString(gifImage),
+	}, &uploaded)
+	if uploaded.Format != "gif" || uploaded.Width != 300 || uploaded.Height != 100 {
+		t.Errorf("unexpected uploaded design %+v", uploaded)
+	}
+	if uploaded.URL != "https://example.com/images/"+uploaded.ID {
+		t.Errorf("unexpected design url %s", uploaded.URL)
+	}
+	if _, ok := env.images.files[uploaded.ID+"_thumb"]; !ok {
+		t.Error("a thumbnail should be stored")
+	}
+
+	syncProduct := schemas.SyncProduct{}
+	env.mustSucceed(t, "create-sync-product", map[string]interface{}{
+		"product_id": 71,
+		"name":       "Shirt",
+		"variants":   []interface{}{map[string]interface{}{"variant_id": 4011, "retail_price": 19}},
+		"files": []interface{}{
+			map[string]interface{}{"type": "front", "image_url": remote.URL + "/design.jpg"},
+			map[string]interface{}{"type": "back", "image_id": uploaded.ID},
+		},
+	}, &syncProduct)
+
+	if len(env.images.files) != 4 {
+		t.Errorf("expected the remote design and its thumbnail to be stored, got %d files", len(env.images.files))
+	}
+
+	for _, source := range []map[string]interface{}{
+		{"image_url": remote.URL + "/missing.jpg"},
+		{"image_url": "ftp://example.com/design.jpg"},
+		{"image_id": "unknown"},
+		{"image": base64.StdEncoding.EncodeToString([]byte("not an image"))},
+	} {
+		source["type"] = "front"
+		response := env.call(t, "create-sync-product", map[string]interface{}{
+			"product_id": 71,
+			"name":       "Shirt",
+			"variants":   []interface{}{map[string]interface{}{"variant_id": 4011, "retail_price": 19}},
+			"files":      []interface{}{source},
+		})
+		if response.Success {
+			t.Errorf("design %v should be rejected", source)
+		}
+	}
+}
+
+func TestArtworkValidation(t *testing.T) {
+	env := newTestEnv(t)
+
+	small := encodeTestImage(t, newTestImage(300, 100, color.Transparent), png.Encode)
+	large := encodeTestImage(t, newTestImage(1800, 2400, color.White), png.Encode)
+	smallFile := map[string]interface{}{"type": "front", "image": base64.StdEncoding.EncodeToString(small)}
+	largeFile := map[string]interface{}{"type": "back", "image": base64.StdEncoding.EncodeToString(large)}
+
+	validation := model.ArtworkValidation{}
+	env.mustSucceed(t, "validate-artwork", map[string]interface{}{
+		"product_id":  71,
+		"variant_ids": []interface{}{4011, 4016},
+		"files":       []interface{}{smallFile, largeFile},
+	}, &validation)
+
+	if !validation.Ready || len(validation.Reports) != 4 {
+		t.Fatalf("unexpected validation %+v", validation)
+	}
+
+	codes := func(report model.ArtworkReport) []string {
+		codes := []string{}
+		for _, w := range report.Warnings {
+			codes = append(codes, w.Code)
+		}
+		return codes
+	}
+
+	front := validation.Reports[0]
+	if front.EffectiveDPI != 25 || front.PrintfileID != 1 {
+		t.Errorf("unexpected front report %+v", front)
+	}
+	if got := strings.Join(codes(front), ","); got != "low_dpi,letterboxing,transparency" {
+		t.Errorf("unexpected front warnings %s", got)
+	}
+
+	if back := validation.Reports[2]; back.EffectiveDPI != 150 || len(back.Warnings) != 0 {
+		t.Errorf("a printfile sized design should be ready, got %+v", back)
+	}
+
+	// 2100x2400 printfile of 2XL
+	if back := validation.Reports[3]; back.EffectiveDPI != 150 || strings.Join(codes(back), ",") != "letterboxing" {
+		t.Errorf("unexpected 2XL back report %+v", back)
+	}
+
+	env.mustSucceed(t, "validate-artwork", map[string]interface{}{
+		"product_id":  71,
+		"variant_ids": []interface{}{4011},
+		"files":       []interface{}{smallFile},
+		"reject":      []interface{}{"low_dpi"},
+	}, &validation)
+	if validation.Ready {
+		t.Error("low resolution artwork should not be ready")
+	}
+
+	response := env.call(t, "validate-artwork", map[string]interface{}{
+		"product_id":  71,
+		"variant_ids": []interface{}{4011},
+		"files":       []interface{}{smallFile},
+		"reject":      []interface{}{"blurry"},
+	})
+	if response.Success || !strings.Contains(response.Error, "reject[0] must be one of") {
+		t.Errorf("unknown warning codes should be rejected, got %+v", response)
+	}
+
+	params := map[string]interface{}{
+		"product_id":     71,
+		"name":           "Shirt",
+		"variants":       []interface{}{map[string]interface{}{"variant_id": 4011, "retail_price": 19}},
+		"files":          []interface{}{smallFile},
+		"reject_artwork": []interface{}{"low_dpi"},
+	}
+	response = env.call(t, "create-sync-product", params)
+	if response.Success || !strings.Contains(response.Error, "artwork rejected: placement front on variant 4011") {
+		t.Errorf("low resolution artwork should be rejected, got %+v", response)
+	}
+	if len(env.images.files) != 0 {
+		t.Error("rejected artwork should not be stored")
+	}
+
+	delete(params, "reject_artwork")
+	created := model.CreatedSyncProduct{}
+	env.mustSucceed(t, "create-sync-product", params, &created)
+	if created.ID == 0 || len(created.ArtworkWarnings) != 1 {
+		t.Errorf("the product should be created with its artwork warnings, got %+v", created)
+	}
+}
+
+func TestSyncProducts(t *testing.T) {
+	env := newTestEnv(t)
+
+	files := []schemas.SyncVariantFile{{Type: "default", URL: "https://example.com/images/design"}}
+	syncProductID := env.printful.AddSyncProduct(
+		schemas.SyncProduct{Name: "Blue shirt", ExternalID: "shirt-1"},
+		[]schemas.SyncVariant{
+			{VariantID: 4011, ExternalID: "shirt-1-s", RetailPrice: "19.00", Files: files},
+			{VariantID: 4012, ExternalID: "shirt-1-m", RetailPrice: "19.00", Files: files},
+		},
+	)
+	env.printful.AddSyncProduct(schemas.SyncProduct{Name: "Red mug"}, []schemas.SyncVariant{{VariantID: 1320, Files: files}})
+
+	type syncVariant struct {
+		ID          int64  `json:"id"`
+		VariantID   int    `json:"variant_id"`
+		ExternalID  string `json:"external_id"`
+		RetailPrice string `json:"retail_price"`
+		Files       []struct {
+			URL string `json:"url"`
+		} `json:"files"`
+	}
+	type syncProductInfo struct {
+		SyncProduct struct {
+			ID       int64  `json:"id"`
+			Name     string `json:"name"`
+			Variants int    `json:"variants"`
+		} `json:"sync_product"`
+		SyncVariants []syncVariant `json:"sync_variants"`
+	}
+
+	list := struct {
+		SyncProducts []struct {
+			Name string `json:"name"`
+		} `json:"sync_products"`
+		Paging struct {
+			Total int `json:"total"`
+		} `json:"paging"`
+	}{}
+	env.mustSucceed(t, "list-sync-products", map[string]interface{}{"offset": 1, "limit": 1}, &list)
+	if list.Paging.Total != 2 || len(list.SyncProducts) != 1 || list.SyncProducts[0].Name != "Red mug" {
+		t.Errorf("unexpected sync product list %+v", list)
+	}
+
+	info := syncProductInfo{}
+	env.mustSucceed(t, "get-sync-product", map[string]interface{}{"external_id": "shirt-1"}, &info)
+	if info.SyncProduct.ID != syncProductID || len(info.SyncVariants) != 2 {
+		t.Fatalf("unexpected sync product %+v", info)
+	}
+
+	env.mustSucceed(t, "modify-sync-product", map[string]interface{}{"sync_product_id": syncProductID, "name": "Navy shirt"}, &info)
+	if info.SyncProduct.Name != "Navy shirt" || len(info.SyncVariants) != 2 {
+		t.Errorf("unexpected modified sync product %+v", info)
+	}
+
+	variant := syncVariant{}
+	env.mustSucceed(t, "modify-sync-variant", map[string]interface{}{"external_id": "shirt-1-m", "retail_price": 21.5}, &variant)
+	if variant.RetailPrice != "21.50" || variant.VariantID != 4012 || len(variant.Files) != 1 {
+		t.Errorf("unexpected modified sync variant %+v", variant)
+	}
+
+	env.mustSucceed(t, "create-sync-variant", map[string]interface{}{"sync_product_id": syncProductID, "variant_id": 4016, "retail_price": 23}, &variant)
+	if variant.VariantID != 4016 || len(variant.Files) != 1 || variant.Files[0].URL != files[0].URL {
+		t.Errorf("the new sync variant should reuse the design, got %+v", variant)
+	}
+
+	env.mustSucceed(t, "delete-sync-variant", map[string]interface{}{"external_id": "shirt-1-s"}, nil)
+	env.mustSucceed(t, "get-sync-product", map[string]interface{}{"sync_product_id": syncProductID}, &info)
+	if info.SyncProduct.Variants != 2 {
+		t.Errorf("expected 2 variants left, got %+v", info)
+	}
+
+	env.mustSucceed(t, "get-sync-variant", map[string]interface{}{"sync_variant_id": variant.ID}, &variant)
+	if variant.VariantID != 4016 {
+		t.Errorf("unexpected sync variant %+v", variant)
+	}
+
+	env.mustSucceed(t, "delete-sync-product", map[string]interface{}{"external_id": "shirt-1"}, nil)
+	response := env.call(t, "get-sync-product", map[string]interface{}{"sync_product_id": syncProductID})
+	if response.Success {
+		t.Error("a deleted sync product should not be found")
+	}
+}
+
+func TestModifySyncProductDesign(t *testing.T) {
+	env := newTestEnv(t)
+
+	// The external id is escaped in the path sent to Printful
+	externalID := "hoodies/green?size=all#1"
+	options := []schemas.FileOption{{ID: "knitting_position", Value: "left"}}
+	files := []schemas.SyncVariantFile{
+		{Type: "default", URL: "https://example.com/images/front"},
+		{Type: "back", URL: "https://example.com/images/back", Options: options},
+	}
+	env.printful.AddSyncProduct(
+		schemas.SyncProduct{Name: "Green hoodie", ExternalID: externalID},
+		[]schemas.SyncVariant{{VariantID: 4011, Files: files}, {VariantID: 4012, Files: files}},
+	)
+
+	type syncProductInfo struct {
+		SyncVariants []schemas.SyncVariant `json:"sync_variants"`
+	}
+	before := syncProductInfo{}
+	env.mustSucceed(t, "get-sync-product", map[string]interface{}{"external_id": externalID}, &before)
+	if len(before.SyncVariants) != 2 {
+		t.Fatalf("unexpected sync product %+v", before)
+	}
+
+	design := base64.StdEncoding.EncodeToString(encodeTestImage(t, newTestImage(300, 100, color.White), png.Encode))
+	params := map[string]interface{}{"external_id": externalID, "image": design, "placement": "sleeve_left"}
+	if response := env.call(t, "modify-sync-product", params); response.Code != ERROR_VALIDATION {
+		t.Errorf("a placement no variant has should be refused, got %+v", response)
+	}
+
+	// Only the file of the placement is replaced, the others keep their id
+	params["placement"] = "back"
+	after := syncProductInfo{}
+	env.mustSucceed(t, "modify-sync-product", params, &after)
+	for i, v := range after.SyncVariants {
+		previous := before.SyncVariants[i].Files
+		if len(v.Files) != 2 || v.Files[0].ID != previous[0].ID || v.Files[0].URL != previous[0].URL {
+			t.Errorf("the default file should be kept, got %+v", v.Files)
+		}
+		if v.Files[1].Type != "back" || v.Files[1].URL == previous[1].URL || !reflect.DeepEqual(v.Files[1].Options, options) {
+			t.Errorf("the back file should be replaced with its options kept, got %+v", v.Files[1])
+		}
+	}
+
+	// A failure part way reports the variants already updated
+	first, second := after.SyncVariants[0].ID, after.SyncVariants[1].ID
+	env.printful.FailNextTo("/store/variants/"+strconv.FormatInt(second, 10), http.StatusBadRequest)
+	response := env.call(t, "modify-sync-product", params)
+	if response.Success || response.Code != ERROR_UPSTREAM || !reflect.DeepEqual(response.UpdatedSyncVariantIDs, []int64{first}) {
+		t.Errorf("the updated variants should be reported, got %+v", response)
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	env := newTestEnv(t, printful.WithConfig(config.Printful{WebhookSecret: "s3cr3t"}))
+
+	webhooks := struct {
+		URL   string   `json:"url"`
+		Types []string `json:"types"`
+	}{}
+	env.mustSucceed(t, "set-webhooks", map[string]interface{}{"url": "https://example.com/webhooks/printful"}, &webhooks)
+	if webhooks.URL != "https://example.com/webhooks/printful" || len(webhooks.Types) != 7 {
+		t.Errorf("unexpected webhooks %+v", webhooks)
+	}
+
+	if url := env.printful.Webhooks()["url"]; url != "https://example.com/webhooks/printful?secret=s3cr3t" {
+		t.Errorf("the shared secret should be sent to printful, got %v", url)
+	}
+
+	env.mustSucceed(t, "get-webhooks", nil, &webhooks)
+	if webhooks.URL != "https://example.com/webhooks/printful" {
+		t.Errorf("the shared secret should not be returned, got %+v", webhooks)
+	}
+
+	env.mustSucceed(t, "disable-webhooks", nil, nil)
+	if env.printful.Webhooks() != nil {
+		t.Error("webhooks should be disabled")
+	}
+}
+
+func TestUnknownAction(t *testing.T) {
+	env := newTestEnv(t)
+
+	response := env.call(t, "no-such-action", nil)
+	if response.Success || response.Status != http.StatusNotFound || response.Code != "not_found" {
+		t.Errorf("unknown action should be not found, got %+v", response)
+	}
+}
+
+func TestActionVersions(t *testing.T) {
+	env := newTestEnv(t)
+
+	response := env.callVersion(t, "get-product", 2, map[string]interface{}{"product_id": 71})
+	if response.Success || response.Status != http.StatusBadRequest || response.Code != "unsupported_version" {
+		t.Errorf("an unknown version should be rejected, got %+v", response)
+	}
+
+	env.handler.Registry().Register("get-product", 2, model.SCOPE_CATALOG_READ, func(h *Handler, ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		return "v2", nil
+	})
+
+	result := ""
+	response = env.callVersion(t, "get-product", 2, map[string]interface{}{"product_id": 71})
+	if err := json.Unmarshal(response.Result, &result); err != nil || result != "v2" {
+		t.Errorf("version 2 should be served by its own handler, got %s", response.Result)
+	}
+
+	product := struct {
+		Product struct {
+			ID int `json:"id"`
+		} `json:"product"`
+	}{}
+	env.mustSucceed(t, "get-product", map[string]interface{}{"product_id": 71}, &product)
+	if product.Product.ID != 71 {
+		t.Errorf("version 1 should be left untouched, got %+v", product)
+	}
+
+	versions := map[string][]int{}
+	env.mustSucceed(t, "get-api-versions", nil, &versions)
+	if got := versions["get-product"]; len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Errorf("unexpected get-product versions %v", got)
+	}
+	if got := versions["create-order"]; len(got) != 1 || got[0] != 1 {
+		t.Errorf("unexpected create-order versions %v", got)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	env := newTestEnv(t)
+
+	body, err := json.Marshal([]interface{}{
+		map[string]interface{}{"id": "product", "action": "get-product", "version": 1, "params": map[string]interface{}{"product_id": 71}},
+		map[string]interface{}{"id": 2, "action": "get-templates", "version": 1, "params": map[string]interface{}{"product_id": 71}},
+		map[string]interface{}{"id": "printfiles", "action": "get-printfiles", "version": 1, "params": map[string]interface{}{"product_id": 71}},
+		map[string]interface{}{"id": "unknown", "action": "no-such-action", "version": 1},
+		map[string]interface{}{"id": "invalid", "params": map[string]interface{}{}},
+		map[string]interface{}{"action": "get-product", "version": 1, "params": map[string]interface{}{}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	env.engine.ServeHTTP(w, httptest.NewRequest("POST", "/api", bytes.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", w.Code, w.Body.String())
+	}
+
+	results := []struct {
+		ID interface{} `json:"id"`
+		apiResponse
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		id      interface{}
+		success bool
+		code    string
+	}{
+		{"product", true, ""},
+		{float64(2), true, ""},
+		{"printfiles", true, ""},
+		{"unknown", false, "not_found"},
+		{"invalid", false, "validation_error"},
+		{nil, false, "validation_error"},
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("expected %d results, got %s", len(expected), w.Body.String())
+	}
+	for i, e := range expected {
+		r := results[i]
+		if r.ID != e.id || r.Success != e.success || r.Code != e.code {
+			t.Errorf("result %d: expected %v %v %q, got %v %v %q (%s)", i, e.id, e.success, e.code, r.ID, r.Success, r.Code, r.Error)
+		}
+	}
+
+	printfiles := struct {
+		ProductID int `json:"product_id"`
+	}{}
+	if err := json.Unmarshal(results[2].Result, &printfiles); err != nil || printfiles.ProductID != 71 {
+		t.Errorf("unexpected printfiles result %s", results[2].Result)
+	}
+
+	w = httptest.NewRecorder()
+	env.engine.ServeHTTP(w, httptest.NewRequest("POST", "/api", strings.NewReader("[]")))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("an empty batch should be rejected, got %d", w.Code)
+	}
+}
+
+func TestUpstreamError(t *testing.T) {
+	env := newTestEnv(t)
+
+	env.printful.FailNext(http.StatusInternalServerError, printful.DefaultRetryPolicy.MaxAttempts)
+	response := env.call(t, "get-templates", map[string]interface{}{"product_id": 71})
+	if response.Success || response.Status != http.StatusBadGateway || response.Code != "upstream_error" {
+		t.Errorf("a 5xx from printful on every attempt should be an upstream error, got %+v", response)
+	}
+	if response.Printful.Status != http.StatusInternalServerError || response.Printful.Code != http.StatusInternalServerError {
+		t.Errorf("printful status and code should be forwarded, got %+v", response.Printful)
+	}
+
+	response = env.call(t, "get-product", map[string]interface{}{"product_id": 12345})
+	if response.Success || response.Status != http.StatusNotFound || response.Code != "not_found" {
+		t.Errorf("an unknown product should be not found, got %+v", response)
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	env := newTestEnv(t, printful.WithConfig(config.Printful{SimulateMockup: true}))
+
+	for _, test := range []struct {
+		action string
+		params map[string]interface{}
+		status int
+		code   string
+	}{
+		{"get-order", map[string]interface{}{}, http.StatusBadRequest, "validation_error"},
+		{"get-order", map[string]interface{}{"order_id": "abc"}, http.StatusBadRequest, "validation_error"},
+		{"get-order", map[string]interface{}{"order_id": 999}, http.StatusNotFound, "not_found"},
+		{"upload-image", map[string]interface{}{"image_id": "unknown"}, http.StatusBadRequest, "validation_error"},
+		{"get-mockup-task", map[string]interface{}{"task_key": "unknown"}, http.StatusNotFound, "not_found"},
+	} {
+		response := env.call(t, test.action, test.params)
+		if response.Success || response.Status != test.status || response.Code != test.code {
+			t.Errorf("%s %v: expected %d %s, got %d %s (%s)", test.action, test.params, test.status, test.code, response.Status, response.Code, response.Error)
+		}
+	}
+}
+
+func TestSlowUpstream(t *testing.T) {
+	env := newTestEnv(t, printful.WithHTTPClient(&http.Client{Timeout: 50 * time.Millisecond}))
+
+	env.printful.SetDelay(time.Second)
+	response := env.call(t, "get-countries", nil)
+	if response.Success || response.Code != "upstream_error" || response.Printful.Status != 0 {
+		t.Errorf("a reply slower than the client timeout should be an upstream error, got %+v", response)
+	}
+}
+
+func TestRateLimitedReply(t *testing.T) {
+	server := printfultest.NewServer()
+	defer server.Close()
+
+	server.RateLimitNext(1, 30)
+	resp, err := http.Get(server.URL + "/countries")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("expected 429, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") != "0" || resp.Header.Get("Retry-After") != "30" {
+		t.Errorf("missing rate limit headers %v", resp.Header)
+	}
+}
+
+func TestAllowOriginKeepsOrigins(t *testing.T) {
+	store := &memoryKeys{keys: []model.ApiKey{{ID: "app", AllowedOrigins: []string{"https://app.example.com"}}}}
+	auth := NewAuthenticator(nil, store)
+	if !auth.AllowOrigin("https://app.example.com") {
+		t.Fatal("the origins of a stored key should be allowed")
+	}
+
+	// A store failing on a refresh doesn't lock the browsers out
+	store.mutex.Lock()
+	store.listErr = errors.New("store unavailable")
+	store.mutex.Unlock()
+	auth.invalidateOrigins()
+	if !auth.AllowOrigin("https://app.example.com") {
+		t.Error("the previous origins should be kept when the store fails")
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	auth := NewAuthenticator([]config.APIKey{
+		{Name: "shop", Key: "shop-key", Scopes: []string{model.SCOPE_CATALOG_READ}},
+		{Name: "admin", Key: "admin-key", Scopes: []string{model.SCOPE_ADMIN}},
+	}, nil)
+	engine := gin.New()
+	engine.GET("/metrics", auth.Middleware(), RequireScope(model.SCOPE_ADMIN), func(c *gin.Context) { c.String(http.StatusOK, "metrics") })
+
+	for key, status := range map[string]int{"": http.StatusUnauthorized, "shop-key": http.StatusForbidden, "admin-key": http.StatusOK} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		if key != "" {
+			req.Header.Set(API_KEY_HEADER, key)
+		}
+		engine.ServeHTTP(w, req)
+		if w.Code != status {
+			t.Errorf("key %q: expected %d, got %d", key, status, w.Code)
+		}
+	}
+}
+
+func TestApiKeys(t *testing.T) {
+	env := newTestEnv(t)
+	auth := NewAuthenticator([]config.APIKey{
+		{Name: "shop", Key: "shop-key", Scopes: []string{model.SCOPE_CATALOG_READ}, AllowedOrigins: []string{"https://shop.example.com"}},
+		{Name: "admin", Key: "admin-key", Scopes: []string{model.SCOPE_ADMIN}},
+	}, &memoryKeys{})
+	env.withAuth(auth)
+
+	response := env.call(t, "get-countries", nil)
+	if response.Status != http.StatusUnauthorized || response.Code != "unauthorized" {
+		t.Errorf("a call without key should be unauthorized, got %d %s", response.Status, response.Code)
+	}
+
+	env.headers.Set(API_KEY_HEADER, "wrong-key")
+	if response = env.call(t, "get-countries", nil); response.Status != http.StatusUnauthorized {
+		t.Errorf("a call with an unknown key should be unauthorized, got %d", response.Status)
+	}
+
+	env.headers.Set(API_KEY_HEADER, "shop-key")
+	env.mustSucceed(t, "get-countries", nil, nil)
+
+	if response = env.call(t, "get-webhooks", nil); response.Status != http.StatusForbidden || response.Code != "forbidden" {
+		t.Errorf("a key without the admin scope should be forbidden, got %d %s", response.Status, response.Code)
+	}
+
+	env.headers.Set("Origin", "https://other.example.com")
+	if response = env.call(t, "get-countries", nil); response.Status != http.StatusForbidden {
+		t.Errorf("an origin not allowed by the key should be forbidden, got %d", response.Status)
+	}
+	if !auth.AllowOrigin("https://shop.example.com") || auth.AllowOrigin("https://other.example.com") {
+		t.Error("CORS should only allow the origins of the keys")
+	}
+	env.headers.Del("Origin")
+
+	env.headers.Set(API_KEY_HEADER, "admin-key")
+	env.headers.Set("Origin", "https://shop.example.com")
+	if response = env.call(t, "get-webhooks", nil); response.Status != http.StatusForbidden {
+		t.Errorf("a key without allowed origins should not be usable from a browser, got %d", response.Status)
+	}
+	env.headers.Del("Origin")
+	if response = env.call(t, "create-api-key", map[string]interface{}{"name": "app", "scopes": []interface{}{"everything"}}); response.Code != "validation_error" {
+		t.Errorf("an unknown scope should be rejected, got %s", response.Code)
+	}
+
+	created := model.CreatedApiKey{}
+	env.mustSucceed(t, "create-api-key", map[string]interface{}{
+		"name":            "app",
+		"scopes":          []interface{}{"pricing", "catalog-read"},
+		"allowed_origins": []interface{}{"https://app.example.com"},
+	}, &created)
+	if created.Key == "" || created.ID == "" {
+		t.Fatalf("the created key should be returned once, got %+v", created)
+	}
+	if !auth.AllowOrigin("https://app.example.com") {
+		t.Error("the origins of a created key should be allowed at once")
+	}
+
+	keys := []model.ApiKey{}
+	env.mustSucceed(t, "list-api-keys", nil, &keys)
+	if len(keys) != 3 || keys[0].ID != "config-admin" || keys[2].ID != created.ID {
+		t.Errorf("unexpected keys %+v", keys)
+	}
+	if response = env.call(t, "revoke-api-key", map[string]interface{}{"id": "config-shop"}); response.Code != "validation_error" {
+		t.Errorf("a configured key shouldn't be revoked, got %s", response.Code)
+	}
+
+	env.headers.Set(API_KEY_HEADER, created.Key)
+	env.mustSucceed(t, "get-countries", nil, nil)
+
+	env.headers.Set(API_KEY_HEADER, "admin-key")
+	env.mustSucceed(t, "revoke-api-key", map[string]interface{}{"id": created.ID}, nil)
+	if response = env.call(t, "revoke-api-key", map[string]interface{}{"id": "unknown"}); response.Code != "not_found" {
+		t.Errorf("revoking an unknown key should be not found, got %s", response.Code)
+	}
+
+	env.headers.Set(API_KEY_HEADER, created.Key)
+	if response = env.call(t, "get-countries", nil); response.Status != http.StatusUnauthorized {
+		t.Errorf("a revoked key should be unauthorized, got %d", response.Status)
+	}
+}
+
+func TestRateLimits(t *testing.T) {
+	env := newTestEnv(t)
+
+	now := time.Date(2024, 5, 1, 23, 0, 0, 0, time.UTC)
+	limiter := NewLimiter(config.RateLimits{
+		Classes:    map[string]config.Bucket{model.SCOPE_CATALOG_READ: {Rate: 0.5, Burst: 2}},
+		DailyQuota: 5,
+	})
+	limiter.now = func() time.Time { return now }
+	env.handler.limiter = limiter
+
+	env.mustSucceed(t, "get-countries", nil, nil)
+	env.mustSucceed(t, "get-countries", nil, nil)
+
+	response := env.call(t, "get-countries", nil)
+	if response.Status != http.StatusTooManyRequests || response.Code != "rate_limited" {
+		t.Fatalf("an empty bucket should be rate limited, got %d %s", response.Status, response.Code)
+	}
+	if response.RetryAfter != 2 {
+		t.Errorf("expected to retry after 2s, got %d", response.RetryAfter)
+	}
+
+	// Other classes have their own bucket
+	env.mustSucceed(t, "get-api-versions", nil, nil)
+
+	now = now.Add(2 * time.Second)
+	env.mustSucceed(t, "get-countries", nil, nil)
+
+	usage := []model.ClientUsage{}
+	env.mustSucceed(t, "get-usage", nil, &usage)
+	if len(usage) != 1 || usage[0].Requests != 5 || usage[0].Buckets[model.SCOPE_CATALOG_READ] != 0 || usage[0].Buckets["admin"] != DEFAULT_BUCKET_BURST-1 {
+		t.Errorf("unexpected usage %+v", usage)
+	}
+
+	now = now.Add(time.Minute)
+	response = env.call(t, "get-countries", nil)
+	if response.Status != http.StatusTooManyRequests || response.Code != "quota_exceeded" || response.RetryAfter != 3538 {
+		t.Errorf("the daily quota should be exceeded until midnight, got %d %s %d", response.Status, response.Code, response.RetryAfter)
+	}
+
+	now = now.Add(time.Hour)
+	env.mustSucceed(t, "get-countries", nil, nil)
+}
+
+func TestUpstreamRateLimitRetry(t *testing.T) {
+	env := newTestEnv(t)
+
+	env.printful.RateLimitNext(1, 1)
+	start := time.Now()
+	env.mustSucceed(t, "get-countries", nil, nil)
+
+	if elapsed := time.Since(start); elapsed < time.Second || elapsed > 5*time.Second {
+		t.Errorf("a 429 should be retried after Retry-After, took %v", elapsed)
+	}
+	if requests := env.printful.Requests(); len(requests) != 2 {
+		t.Errorf("expected the call to be sent twice, got %v", requests)
+	}
+}
+
+func TestDeadlines(t *testing.T) {
+	env := newTestEnv(t)
+	env.handler.actionTimeout = 200 * time.Millisecond
+
+	env.printful.SetDelay(time.Second)
+	start := time.Now()
+	response := env.call(t, "get-countries", nil)
+	if response.Status != http.StatusGatewayTimeout || response.Code != "timeout" {
+		t.Errorf("an action outlasting its deadline should time out, got %d %s", response.Status, response.Code)
+	}
+	if elapsed := time.Since(start); elapsed > 900*time.Millisecond {
+		t.Errorf("the call to printful should be canceled at the deadline, took %v", elapsed)
+	}
+
+	// A retry that can't happen before the deadline is not waited for
+	env.printful.SetDelay(0)
+	env.printful.RateLimitNext(1, 30)
+	start = time.Now()
+	response = env.call(t, "get-countries", nil)
+	if response.Status != http.StatusTooManyRequests || response.Code != "upstream_rate_limited" || response.RetryAfter != 30 {
+		t.Errorf("expected an upstream rate limit error, got %d %s %d", response.Status, response.Code, response.RetryAfter)
+	}
+	if elapsed := time.Since(start); elapsed > 900*time.Millisecond {
+		t.Errorf("the rate limit wait should fail fast, took %v", elapsed)
+	}
+
+	env = newTestEnv(t, printful.WithCallTimeout(100*time.Millisecond))
+	env.printful.SetDelay(time.Second)
+	if response = env.call(t, "get-countries", nil); response.Code != "upstream_error" {
+		t.Errorf("a printful call outlasting the call timeout should be an upstream error, got %s", response.Code)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	env := newTestEnv(t, printful.WithRetryPolicy(printful.RetryPolicy{MaxAttempts: 3, BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond, Budget: 0.1}))
+
+	env.printful.FailNext(http.StatusServiceUnavailable, 2)
+	env.mustSucceed(t, "get-countries", nil, nil)
+	if requests := env.printful.Requests(); len(requests) != 3 {
+		t.Errorf("a GET should be retried on 5xx, got %v", requests)
+	}
+
+	order := func(externalID string) map[string]interface{} {
+		return map[string]interface{}{"order": map[string]interface{}{
+			"external_id": externalID,
+			"recipient":   map[string]interface{}{"name": "John Smith", "country_code": "US"},
+			"items":       []interface{}{map[string]interface{}{"sync_variant_id": 1002, "quantity": 2}},
+		}}
+	}
+	created := schemas.Order{}
+
+	// The order wasn't created: it is looked for, then sent again with its whole body
+	env.printful.FailNext(http.StatusBadGateway, 1)
+	env.mustSucceed(t, "create-order", order("retry-1"), &created)
+	if len(created.Items) != 1 || created.ExternalID != "retry-1" {
+		t.Errorf("the retried order should be complete, got %+v", created)
+	}
+
+	// The order was created but the reply was lost: the existing order is returned
+	env.printful.LoseNextReply(http.StatusInternalServerError, 1)
+	env.mustSucceed(t, "create-order", order("retry-2"), &created)
+	orders := struct {
+		Orders []schemas.Order `json:"orders"`
+	}{}
+	env.mustSucceed(t, "list-orders", nil, &orders)
+	count := 0
+	for _, o := range orders.Orders {
+		if o.ExternalID == "retry-2" {
+			count++
+		}
+	}
+	if count != 1 || created.ExternalID != "retry-2" || created.ID == 0 {
+		t.Errorf("the order should be created once, got %d orders and %+v", count, created)
+	}
+}
+
+type memorySubmissions struct {
+	mutex       sync.Mutex
+	submissions map[string]model.OrderSubmission
+}
+
+func (m *memorySubmissions) InsertOrderSubmission(ctx context.Context, submission *model.OrderSubmission) (*model.OrderSubmission, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if previous, ok := m.submissions[submission.ExternalID]; ok {
+		return &previous, nil
+	}
+	m.submissions[submission.ExternalID] = *submission
+	return nil, nil
+}
+
+func (m *memorySubmissions) UpdateOrderSubmission(ctx context.Context, submission *model.OrderSubmission) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.submissions[submission.ExternalID] = *submission
+	return nil
+}
+
+func (m *memorySubmissions) DeleteOrderSubmission(ctx context.Context, externalID string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.submissions, externalID)
+	return nil
+}
+
+func TestOrderSubmissions(t *testing.T) {
+	submissions := &memorySubmissions{submissions: make(map[string]model.OrderSubmission)}
+	env := newTestEnv(t, printful.WithOrderSubmissionStore(submissions))
+
+	order := func(externalID string, quantity int) map[string]interface{} {
+		return map[string]interface{}{"order": map[string]interface{}{
+			"external_id": externalID,
+			"recipient":   map[string]interface{}{"name": "John Smith", "country_code": "US"},
+			"items":       []interface{}{map[string]interface{}{"variant_id": 4012, "quantity": quantity}},
+		}}
+	}
+	countOrders := func() int {
+		orders := struct {
+			Orders []schemas.Order `json:"orders"`
+		}{}
+		env.mustSucceed(t, "list-orders", map[string]interface{}{"limit": 100}, &orders)
+		return len(orders.Orders)
+	}
+
+	first, second := schemas.Order{}, schemas.Order{}
+	env.mustSucceed(t, "create-order", order("order-1", 2), &first)
+	env.mustSucceed(t, "create-order", order("order-1", 2), &second)
+	if first.ID == 0 || second.ID != first.ID || countOrders() != 1 {
+		t.Errorf("a repeated submission should return the existing order, got %d and %d", first.ID, second.ID)
+	}
+	if s := submissions.submissions["order-1"]; s.Status != model.ORDER_SUBMISSION_CREATED || s.OrderID != first.ID {
+		t.Errorf("unexpected submission %+v", s)
+	}
+
+	if response := env.call(t, "create-order", order("order-1", 3)); response.Code != "validation_error" {
+		t.Errorf("reusing an external id for another order should be refused, got %+v", response)
+	}
+
+	if response := env.call(t, "create-order", order("", 1)); response.Code != "validation_error" || countOrders() != 1 {
+		t.Errorf("an order without external id should be refused, got %+v", response)
+	}
+
+	// A submission still in flight
+	submissions.UpdateOrderSubmission(context.Background(), &model.OrderSubmission{
+		ExternalID: "order-2",
+		Hash:       submissions.submissions["order-1"].Hash,
+		Status:     model.ORDER_SUBMISSION_PENDING,
+		Updated:    time.Now(),
+	})
+	if response := env.call(t, "create-order", order("order-2", 2)); response.Status != http.StatusConflict || response.Code != "conflict" {
+		t.Errorf("an order being submitted should conflict, got %+v", response)
+	}
+
+	// A failed submission is forgotten, the order can be sent again
+	env.printful.FailNext(http.StatusBadRequest, 1)
+	if response := env.call(t, "create-order", order("order-3", 2)); response.Success {
+		t.Error("the failed submission should fail")
+	}
+	if _, ok := submissions.submissions["order-3"]; ok {
+		t.Error("a failed submission should not be recorded")
+	}
+	env.mustSucceed(t, "create-order", order("order-3", 2), &first)
+
+	// Without a record, Printful still refuses the external id and the existing order is returned
+	env = newTestEnv(t)
+	env.mustSucceed(t, "create-order", order("order-1", 2), &first)
+	env.mustSucceed(t, "create-order", order("order-1", 2), &second)
+	if second.ID != first.ID || countOrders() != 1 {
+		t.Errorf("a repeated submission without store should return the existing order, got %d and %d", first.ID, second.ID)
+	}
+	if response := env.call(t, "create-order", order("order-1", 3)); response.Code != "validation_error" || countOrders() != 1 {
+		t.Errorf("the order of another submission should not be returned, got %+v", response)
+	}
+
+	// Other refusals are not taken for a known external id
+	env.printful.FailNext(http.StatusBadRequest, 1)
+	if response := env.call(t, "create-order", order("order-1", 2)); response.Code != "upstream_error" {
+		t.Errorf("a refused order should fail, got %+v", response)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	env := newTestEnv(t)
+
+	var failing bool
+	var mutex sync.Mutex
+	health := NewHealth()
+	health.Register("database", func(ctx context.Context) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if failing {
+			return errors.New("database unreachable")
+		}
+		return nil
+	})
+	health.Register("printful", env.handler.printful.Ping)
+
+	engine := gin.New()
+	engine.GET("/healthz", health.LiveHandler)
+	engine.GET("/readyz", health.ReadyHandler)
+	probe := func(path string) (int, model.Readiness) {
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		report := model.Readiness{}
+		json.Unmarshal(w.Body.Bytes(), &report)
+		return w.Code, report
+	}
+
+	if code, _ := probe("/healthz"); code != http.StatusOK {
+		t.Errorf("expected 200, got %d", code)
+	}
+
+	code, report := probe("/readyz")
+	if code != http.StatusOK || !report.Ready || len(report.Checks) != 2 || report.Checks[1].Name != "printful" || !report.Checks[1].OK {
+		t.Fatalf("expected a ready report, got %d %+v", code, report)
+	}
+
+	// The report is cached, a failure shows once it expires
+	mutex.Lock()
+	failing = true
+	mutex.Unlock()
+	if code, _ := probe("/readyz"); code != http.StatusOK {
+		t.Errorf("the cached report should be answered, got %d", code)
+	}
+	health.report.Checked -= int64(READINESS_CACHE.Seconds())
+	code, report = probe("/readyz")
+	if code != http.StatusServiceUnavailable || report.Ready || report.Checks[0].Error != "database unreachable" {
+		t.Errorf("expected a failed report, got %d %+v", code, report)
+	}
+
+	// A wrong access token makes Printful unusable
+	client := printful.NewClient(printful.WithBaseURL(env.printful.URL), printful.WithAccessToken("wrong"))
+	if err := client.Ping(context.Background()); err == nil {
+		t.Error("pinging with a wrong access token should fail")
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	env := newTestEnv(t)
+
+	env.mustSucceed(t, "get-product", map[string]interface{}{"product_id": 71}, nil)
+
+	diagnostics := model.Diagnostics{}
+	env.mustSucceed(t, "get-diagnostics", nil, &diagnostics)
+	if diagnostics.Version != Version || diagnostics.GoVersion == "" || diagnostics.Started == 0 {
+		t.Errorf("unexpected build information %+v", diagnostics)
+	}
+	if diagnostics.Cache.ProductMisses != 1 || diagnostics.Cache.ProductHits != 0 || diagnostics.Cache.WarmedUp {
+		t.Errorf("unexpected cache stats %+v", diagnostics.Cache)
+	}
+	if len(diagnostics.RateLimits) != 1 || diagnostics.RateLimits[0].Endpoint != "/products" || diagnostics.RateLimits[0].Limit != printfultest.RATE_LIMIT {
+		t.Errorf("unexpected rate limits %+v", diagnostics.RateLimits)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	env := newTestEnv(t)
+
+	requests := testutil.ToFloat64(metrics.ActionRequests.WithLabelValues("get-product"))
+	notFound := testutil.ToFloat64(metrics.ActionErrors.WithLabelValues("get-product", "not_found"))
+	unknown := testutil.ToFloat64(metrics.ActionRequests.WithLabelValues(metrics.UNKNOWN_ACTION))
+	replies := testutil.ToFloat64(metrics.PrintfulRequests.WithLabelValues("/products", "200"))
+	rateLimited := testutil.ToFloat64(metrics.PrintfulRateLimited.WithLabelValues("/countries"))
+	misses := testutil.ToFloat64(metrics.CacheLookups.WithLabelValues("product", "miss"))
+
+	env.mustSucceed(t, "get-product", map[string]interface{}{"product_id": 71}, nil)
+	env.call(t, "get-product", map[string]interface{}{"product_id": 999999})
+	env.call(t, "no-such-action", nil)
+	env.printful.RateLimitNext(1, 0)
+	env.mustSucceed(t, "get-countries", nil, nil)
+
+	for _, test := range []struct {
+		name     string
+		before   float64
+		after    float64
+		expected float64
+	}{
+		{"action requests", requests, testutil.ToFloat64(metrics.ActionRequests.WithLabelValues("get-product")), 2},
+		{"action errors", notFound, testutil.ToFloat64(metrics.ActionErrors.WithLabelValues("get-product", "not_found")), 1},
+		{"unknown actions", unknown, testutil.ToFloat64(metrics.ActionRequests.WithLabelValues(metrics.UNKNOWN_ACTION)), 1},
+		{"printful replies", replies, testutil.ToFloat64(metrics.PrintfulRequests.WithLabelValues("/products", "200")), 1},
+		{"printful 429", rateLimited, testutil.ToFloat64(metrics.PrintfulRateLimited.WithLabelValues("/countries")), 1},
+		{"cache misses", misses, testutil.ToFloat64(metrics.CacheLookups.WithLabelValues("product", "miss")), 2},
+	} {
+		if test.after-test.before != test.expected {
+			t.Errorf("%s: expected %v more, got %v", test.name, test.expected, test.after-test.before)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(w.Body.String(), `printfulapi_action_duration_seconds_count{action="get-product"}`) {
+		t.Errorf("the action latency should be exposed, got %s", w.Body.String())
+	}
+}
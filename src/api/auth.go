@@ -0,0 +1,283 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"printfulapi/src/config"
+	"printfulapi/src/model"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/baldurstod/randstr"
+	"github.com/gin-gonic/gin"
+)
+
+// Header carrying the API key of the client
+const API_KEY_HEADER = "X-Api-Key"
+
+// Context key of the authenticated *model.ApiKey
+const API_KEY_CONTEXT = "api_key"
+
+// Time the allowed origins of stored keys are kept before being listed again
+const ORIGINS_REFRESH = time.Minute
+
+// Time listing the stored keys may take when the allowed origins are refreshed
+const ORIGINS_LIST_TIMEOUT = 5 * time.Second
+
+// KeyStore keeps the API keys created by the admin actions
+type KeyStore interface {
+	InsertApiKey(ctx context.Context, key *model.ApiKey) error
+	// FindApiKey returns nil when no key matches the hash
+	FindApiKey(ctx context.Context, hash string) (*model.ApiKey, error)
+	ListApiKeys(ctx context.Context) ([]model.ApiKey, error)
+	// RevokeApiKey returns false when no key matches the id
+	RevokeApiKey(ctx context.Context, id string) (bool, error)
+}
+
+// Authenticator checks the API key of the requests against the configured keys and the key store
+type Authenticator struct {
+	configKeys map[string]*model.ApiKey
+	store      KeyStore
+
+	origins        map[string]bool
+	originsUpdated time.Time
+	originsMutex   sync.Mutex
+}
+
+func NewAuthenticator(keys []config.APIKey, store KeyStore) *Authenticator {
+	a := &Authenticator{
+		configKeys: make(map[string]*model.ApiKey),
+		store:      store,
+	}
+
+	for _, k := range keys {
+		if k.Key == "" {
+			slog.Warn("ignoring API key without key", "name", k.Name)
+			continue
+		}
+		hash := hashApiKey(k.Key)
+		a.configKeys[hash] = &model.ApiKey{
+			ID:             "config-" + k.Name,
+			Name:           k.Name,
+			Hash:           hash,
+			Scopes:         k.Scopes,
+			AllowedOrigins: k.AllowedOrigins,
+		}
+	}
+
+	return a
+}
+
+func hashApiKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Middleware rejects the requests without a valid key, or coming from an origin the key doesn't allow
+func (a *Authenticator) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, err := a.findKey(c.Request.Context(), c.GetHeader(API_KEY_HEADER))
+		if err != nil {
+			jsonError(c, err)
+			c.Abort()
+			return
+		}
+
+		// Browsers send an Origin, CORS only lets through the origins listed by the keys
+		origin := c.GetHeader("Origin")
+		if origin != "" && !containsString(key.AllowedOrigins, origin) {
+			jsonError(c, ForbiddenError{Message: "origin " + origin + " is not allowed for this API key"})
+			c.Abort()
+			return
+		}
+
+		c.Set(API_KEY_CONTEXT, key)
+		c.Next()
+	}
+}
+
+func (a *Authenticator) findKey(ctx context.Context, key string) (*model.ApiKey, error) {
+	if key == "" {
+		return nil, UnauthorizedError{Message: "missing API key"}
+	}
+
+	hash := hashApiKey(key)
+	if k, ok := a.configKeys[hash]; ok {
+		return k, nil
+	}
+
+	if a.store != nil {
+		k, err := a.store.FindApiKey(ctx, hash)
+		if err != nil {
+			return nil, err
+		}
+		if k != nil && !k.Revoked {
+			return k, nil
+		}
+	}
+
+	return nil, UnauthorizedError{Message: "invalid API key"}
+}
+
+// AllowOrigin tells the CORS middleware whether an origin is listed by one of the keys
+func (a *Authenticator) AllowOrigin(origin string) bool {
+	a.originsMutex.Lock()
+	defer a.originsMutex.Unlock()
+
+	if a.origins == nil || time.Since(a.originsUpdated) > ORIGINS_REFRESH {
+		a.refreshOrigins()
+	}
+
+	return a.origins[origin]
+}
+
+func (a *Authenticator) refreshOrigins() {
+	origins := make(map[string]bool)
+	for _, k := range a.configKeys {
+		for _, o := range k.AllowedOrigins {
+			origins[o] = true
+		}
+	}
+
+	if a.store != nil {
+		// The CORS middleware has no request context to offer, and every origin check waits for this one
+		ctx, cancel := context.WithTimeout(context.Background(), ORIGINS_LIST_TIMEOUT)
+		defer cancel()
+
+		keys, err := a.store.ListApiKeys(ctx)
+		if err != nil {
+			slog.Error("unable to list the allowed origins", "error", err)
+			// Keep the previous list rather than locking browsers out, until the next refresh
+			a.originsUpdated = time.Now()
+			if a.origins != nil {
+				return
+			}
+		}
+		for _, k := range keys {
+			if k.Revoked {
+				continue
+			}
+			for _, o := range k.AllowedOrigins {
+				origins[o] = true
+			}
+		}
+	}
+
+	a.origins = origins
+	a.originsUpdated = time.Now()
+}
+
+// invalidateOrigins has the allowed origins listed again on the next check, the current list stays until then
+func (a *Authenticator) invalidateOrigins() {
+	a.originsMutex.Lock()
+	defer a.originsMutex.Unlock()
+
+	a.originsUpdated = time.Time{}
+}
+
+// RequireScope lets through the requests whose key, authenticated by Middleware, grants scope
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := authorize(c, scope); err != nil {
+			jsonError(c, err)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// authorize checks the key authenticated by the middleware grants scope
+func authorize(c *gin.Context, scope string) error {
+	value, ok := c.Get(API_KEY_CONTEXT)
+	if !ok {
+		return UnauthorizedError{Message: "missing API key"}
+	}
+
+	key := value.(*model.ApiKey)
+	if scope != "" && !key.HasScope(scope) {
+		return ForbiddenError{Message: "API key lacks the " + scope + " scope"}
+	}
+
+	return nil
+}
+
+func (a *Authenticator) createApiKey(ctx context.Context, request model.CreateApiKeyRequest) (*model.CreatedApiKey, error) {
+	if a.store == nil {
+		return nil, ValidationError{Message: "no API key store configured"}
+	}
+
+	secret := randstr.String(40)
+	key := model.ApiKey{
+		ID:             randstr.String(16),
+		Name:           request.Name,
+		Hash:           hashApiKey(secret),
+		Scopes:         request.Scopes,
+		AllowedOrigins: request.AllowedOrigins,
+		Created:        time.Now().Unix(),
+	}
+	if key.AllowedOrigins == nil {
+		key.AllowedOrigins = []string{}
+	}
+
+	if err := a.store.InsertApiKey(ctx, &key); err != nil {
+		return nil, err
+	}
+	a.invalidateOrigins()
+
+	return &model.CreatedApiKey{ApiKey: key, Key: secret}, nil
+}
+
+func (a *Authenticator) revokeApiKey(ctx context.Context, id string) error {
+	for _, k := range a.configKeys {
+		if k.ID == id {
+			return ValidationError{Message: "keys defined in the configuration can't be revoked"}
+		}
+	}
+
+	if a.store == nil {
+		return NotFoundError{Message: "API key " + id + " not found"}
+	}
+
+	found, err := a.store.RevokeApiKey(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return NotFoundError{Message: "API key " + id + " not found"}
+	}
+	a.invalidateOrigins()
+
+	return nil
+}
+
+func (a *Authenticator) listApiKeys(ctx context.Context) ([]model.ApiKey, error) {
+	keys := []model.ApiKey{}
+	for _, k := range a.configKeys {
+		keys = append(keys, *k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+
+	if a.store != nil {
+		stored, err := a.store.ListApiKeys(ctx)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, stored...)
+	}
+
+	return keys, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
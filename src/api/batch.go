@@ -0,0 +1,89 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+const MAX_BATCH_SIZE = 50
+
+// Actions of a batch running at the same time, their Printful calls still wait for the per-endpoint rate limiter of the client
+const BATCH_CONCURRENCY = 8
+
+func isBatch(body []byte) bool {
+	trimmed := bytes.TrimLeft(body, " \t\r\n")
+	return len(trimmed) > 0 && trimmed[0] == '['
+}
+
+// batchHandler runs an array of requests concurrently and answers their results in the same order
+func (h *Handler) batchHandler(c *gin.Context, body []byte) {
+	items := []json.RawMessage{}
+	if err := json.Unmarshal(body, &items); err != nil {
+		jsonError(c, ValidationError{Message: "bad request"})
+		return
+	}
+
+	if len(items) == 0 {
+		jsonError(c, ValidationError{Message: "batch is empty"})
+		return
+	}
+
+	if len(items) > MAX_BATCH_SIZE {
+		jsonError(c, ValidationError{Message: fmt.Sprintf("batch is limited to %d requests", MAX_BATCH_SIZE)})
+		return
+	}
+
+	results := make([]gin.H, len(items))
+	semaphore := make(chan struct{}, BATCH_CONCURRENCY)
+	wg := sync.WaitGroup{}
+
+	for i, item := range items {
+		wg.Add(1)
+		go func(i int, item json.RawMessage) {
+			defer wg.Done()
+
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			results[i] = h.batchItem(c, item)
+		}(i, item)
+	}
+
+	wg.Wait()
+
+	c.JSON(http.StatusOK, results)
+}
+
+func (h *Handler) batchItem(c *gin.Context, item json.RawMessage) gin.H {
+	request, err := parseApiRequest(item)
+	if err != nil {
+		_, body := errorBody(c.Request.Context(), ValidationError{Message: "bad request"})
+		// Echo the id even if the rest of the request is invalid
+		partial := struct {
+			ID interface{} `json:"id"`
+		}{}
+		if json.Unmarshal(item, &partial) == nil && partial.ID != nil {
+			body["id"] = partial.ID
+		}
+		return body
+	}
+
+	var body gin.H
+	result, err := h.runAction(c, request)
+	if err != nil {
+		_, body = errorBody(c.Request.Context(), err)
+	} else {
+		body = successBody(result)
+	}
+
+	if request.ID != nil {
+		body["id"] = request.ID
+	}
+
+	return body
+}
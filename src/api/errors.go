@@ -1,7 +1,193 @@
 package api
 
-type NotFoundError struct{}
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"printfulapi/src/printful"
+	"time"
+)
+
+// Stable error codes returned to the frontend
+const ERROR_NOT_FOUND = "not_found"
+const ERROR_UNAUTHORIZED = "unauthorized"
+const ERROR_FORBIDDEN = "forbidden"
+const ERROR_VALIDATION = "validation_error"
+const ERROR_CONFLICT = "conflict"
+const ERROR_UNSUPPORTED_VERSION = "unsupported_version"
+const ERROR_RATE_LIMITED = "rate_limited"
+const ERROR_QUOTA_EXCEEDED = "quota_exceeded"
+const ERROR_UPSTREAM_RATE_LIMITED = "upstream_rate_limited"
+const ERROR_UPSTREAM = "upstream_error"
+const ERROR_TIMEOUT = "timeout"
+const ERROR_INTERNAL = "internal_error"
+
+// apiError is an error answered with its own HTTP status and code
+type apiError interface {
+	error
+	Status() int
+	Code() string
+}
+
+type NotFoundError struct {
+	Message string
+}
 
 func (e NotFoundError) Error() string {
-	return "Not found"
+	if e.Message == "" {
+		return "Not found"
+	}
+	return e.Message
+}
+
+func (e NotFoundError) Status() int  { return http.StatusNotFound }
+func (e NotFoundError) Code() string { return ERROR_NOT_FOUND }
+
+// UnauthorizedError is returned when the API key is missing or unknown
+type UnauthorizedError struct {
+	Message string
+}
+
+func (e UnauthorizedError) Error() string { return e.Message }
+func (e UnauthorizedError) Status() int   { return http.StatusUnauthorized }
+func (e UnauthorizedError) Code() string  { return ERROR_UNAUTHORIZED }
+
+// ForbiddenError is returned when the API key doesn't grant the action
+type ForbiddenError struct {
+	Message string
+}
+
+func (e ForbiddenError) Error() string { return e.Message }
+func (e ForbiddenError) Status() int   { return http.StatusForbidden }
+func (e ForbiddenError) Code() string  { return ERROR_FORBIDDEN }
+
+type ValidationError struct {
+	Message string
+	// Bad parameters, when the error comes from the params of the action
+	Fields []FieldError
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e ValidationError) Error() string { return e.Message }
+func (e ValidationError) Status() int   { return http.StatusBadRequest }
+func (e ValidationError) Code() string  { return ERROR_VALIDATION }
+
+// ConflictError is returned when the same order is submitted again before the first submission ends
+type ConflictError struct {
+	Message string
+}
+
+func (e ConflictError) Error() string { return e.Message }
+func (e ConflictError) Status() int   { return http.StatusConflict }
+func (e ConflictError) Code() string  { return ERROR_CONFLICT }
+
+// UnsupportedVersionError is returned when an action exists but not in the requested version
+type UnsupportedVersionError struct {
+	Action    string
+	Version   int
+	Supported []int
+}
+
+func (e UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("action %s does not support version %d", e.Action, e.Version)
+}
+
+func (e UnsupportedVersionError) Status() int  { return http.StatusBadRequest }
+func (e UnsupportedVersionError) Code() string { return ERROR_UNSUPPORTED_VERSION }
+
+// RateLimitedError is returned when a client calls more than its own limits allow
+type RateLimitedError struct {
+	Message    string
+	RetryAfter time.Duration
+	// Set when the daily quota is exhausted rather than the rate limit
+	Quota bool
+}
+
+func (e RateLimitedError) Error() string { return e.Message }
+func (e RateLimitedError) Status() int   { return http.StatusTooManyRequests }
+func (e RateLimitedError) Code() string {
+	if e.Quota {
+		return ERROR_QUOTA_EXCEEDED
+	}
+	return ERROR_RATE_LIMITED
+}
+
+type UpstreamRateLimitedError struct {
+	RetryAfter time.Duration
+}
+
+func (e UpstreamRateLimitedError) Error() string { return "printful rate limit exceeded" }
+func (e UpstreamRateLimitedError) Status() int   { return http.StatusTooManyRequests }
+func (e UpstreamRateLimitedError) Code() string  { return ERROR_UPSTREAM_RATE_LIMITED }
+
+// UpstreamError carries the error Printful answered with, PrintfulStatus is 0 when Printful was unreachable
+type UpstreamError struct {
+	Message        string
+	PrintfulStatus int
+	PrintfulCode   int
+	PrintfulReason string
+}
+
+func (e UpstreamError) Error() string { return e.Message }
+func (e UpstreamError) Status() int   { return http.StatusBadGateway }
+func (e UpstreamError) Code() string  { return ERROR_UPSTREAM }
+
+// TimeoutError is returned when an action outlasts its deadline
+type TimeoutError struct {
+	Message string
+}
+
+func (e TimeoutError) Error() string { return e.Message }
+func (e TimeoutError) Status() int   { return http.StatusGatewayTimeout }
+func (e TimeoutError) Code() string  { return ERROR_TIMEOUT }
+
+// InternalError hides the cause of unexpected errors, which is only logged
+type InternalError struct{}
+
+func (e InternalError) Error() string { return "Internal error" }
+func (e InternalError) Status() int   { return http.StatusInternalServerError }
+func (e InternalError) Code() string  { return ERROR_INTERNAL }
+
+// toApiError classifies any error returned by an action
+func toApiError(err error) apiError {
+	var e apiError
+	if errors.As(err, &e) {
+		return e
+	}
+
+	var notFound printful.NotFoundError
+	if errors.As(err, &notFound) {
+		return NotFoundError{Message: notFound.Message}
+	}
+
+	var validation printful.ValidationError
+	if errors.As(err, &validation) {
+		return ValidationError{Message: err.Error()}
+	}
+
+	var conflict printful.ConflictError
+	if errors.As(err, &conflict) {
+		return ConflictError{Message: conflict.Message}
+	}
+
+	var rateLimited printful.RateLimitedError
+	if errors.As(err, &rateLimited) {
+		return UpstreamRateLimitedError{RetryAfter: rateLimited.RetryAfter}
+	}
+
+	var upstream printful.UpstreamError
+	if errors.As(err, &upstream) {
+		return UpstreamError{
+			Message:        upstream.Message,
+			PrintfulStatus: upstream.StatusCode,
+			PrintfulCode:   upstream.Code,
+			PrintfulReason: upstream.Reason,
+		}
+	}
+
+	return InternalError{}
 }
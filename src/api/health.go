@@ -0,0 +1,135 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"printfulapi/src/model"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Version of the build, set with -ldflags "-X printfulapi/src/api.Version=..."
+var Version = "dev"
+
+// Time a readiness report is answered again before the checks run anew
+const READINESS_CACHE = 10 * time.Second
+
+// Deadline of each readiness check
+const READINESS_CHECK_TIMEOUT = 5 * time.Second
+
+// HealthCheck returns nil when a dependency of the service is usable
+type HealthCheck func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check HealthCheck
+}
+
+// Health answers the liveness and readiness probes
+type Health struct {
+	checks []namedCheck
+
+	report *model.Readiness
+	mutex  sync.Mutex
+}
+
+func NewHealth() *Health {
+	return &Health{}
+}
+
+// Register adds a check to the readiness report, it must be called before the probes are served
+func (h *Health) Register(name string, check HealthCheck) {
+	h.checks = append(h.checks, namedCheck{name: name, check: check})
+}
+
+// LiveHandler answers as long as the process serves requests
+func (h *Health) LiveHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// ReadyHandler answers 503 when one of the checks fails
+func (h *Health) ReadyHandler(c *gin.Context) {
+	report := h.Readiness(c.Request.Context())
+
+	status := http.StatusOK
+	if !report.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
+
+// Readiness runs the checks at once, or returns the report of the previous run while it is recent enough
+func (h *Health) Readiness(ctx context.Context) model.Readiness {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.report != nil && time.Since(time.Unix(h.report.Checked, 0)) < READINESS_CACHE {
+		return *h.report
+	}
+
+	report := model.Readiness{Ready: true, Checked: time.Now().Unix(), Checks: make([]model.HealthCheck, len(h.checks))}
+
+	wg := sync.WaitGroup{}
+	for i, c := range h.checks {
+		wg.Add(1)
+		go func(i int, c namedCheck) {
+			defer wg.Done()
+			report.Checks[i] = runCheck(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	for _, check := range report.Checks {
+		if !check.OK {
+			report.Ready = false
+		}
+	}
+
+	// A probe which went away didn't run the checks to the end
+	if ctx.Err() == nil {
+		h.report = &report
+	}
+
+	return report
+}
+
+func runCheck(ctx context.Context, c namedCheck) model.HealthCheck {
+	ctx, cancel := context.WithTimeout(ctx, READINESS_CHECK_TIMEOUT)
+	defer cancel()
+
+	start := time.Now()
+	err := c.check(ctx)
+
+	result := model.HealthCheck{Name: c.name, OK: err == nil, Duration: time.Since(start).Milliseconds()}
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+func (h *Handler) getDiagnostics(ctx context.Context) (interface{}, error) {
+	diagnostics := model.Diagnostics{
+		Version:     Version,
+		GoVersion:   runtime.Version(),
+		Started:     h.started.Unix(),
+		Uptime:      int64(time.Since(h.started).Seconds()),
+		Cache:       h.printful.CacheStats(),
+		RateLimits:  h.printful.RateLimits(),
+		RetryBudget: h.printful.RetryBudget(),
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				diagnostics.Revision = setting.Value
+			}
+		}
+	}
+
+	return diagnostics, nil
+}
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"printfulapi/src/mongo"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ImageHandler(c *gin.Context) {
+	image, err := mongo.DownloadImage(c.Request.Context(), c.Param("filename"))
+	if err != nil {
+		if errors.As(err, &mongo.FileNotFoundError{}) {
+			c.Status(http.StatusNotFound)
+		} else {
+			slog.ErrorContext(c.Request.Context(), "unable to download image", "filename", c.Param("filename"), "error", err)
+			c.Status(http.StatusInternalServerError)
+		}
+		return
+	}
+	defer image.Content.Close()
+
+	// Files are never modified once uploaded: the id is a strong validator
+	c.Header("ETag", `"`+image.ID+`"`)
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+
+	// ServeContent sniffs the Content-Type and handles Range and conditional requests
+	http.ServeContent(c.Writer, c.Request, image.Name, image.UploadDate, image.Content)
+}
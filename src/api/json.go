@@ -1,20 +1,76 @@
 package api
 
 import (
-	"github.com/gin-gonic/gin"
+	"context"
+	"errors"
+	"log/slog"
 	"net/http"
+	"printfulapi/src/printful"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
 )
 
 func jsonError(c *gin.Context, e error) {
-	c.JSON(http.StatusOK, gin.H{
+	apiErr, body := errorBody(c.Request.Context(), e)
+
+	switch err := apiErr.(type) {
+	case RateLimitedError:
+		c.Header("Retry-After", strconv.Itoa(int(err.RetryAfter.Seconds())))
+	case UpstreamRateLimitedError:
+		c.Header("Retry-After", strconv.Itoa(int(err.RetryAfter.Seconds())))
+	}
+
+	c.JSON(apiErr.Status(), body)
+}
+
+// errorBody classifies an error and returns the JSON describing it
+func errorBody(ctx context.Context, e error) (apiError, gin.H) {
+	apiErr := toApiError(e)
+
+	body := gin.H{
 		"success": false,
-		"error":   e.Error(),
-	})
+		"error":   apiErr.Error(),
+		"code":    apiErr.Code(),
+	}
+
+	switch err := apiErr.(type) {
+	case InternalError:
+		slog.ErrorContext(ctx, "internal error", "error", e)
+	case UnsupportedVersionError:
+		body["supported_versions"] = err.Supported
+	case ValidationError:
+		if len(err.Fields) > 0 {
+			body["fields"] = err.Fields
+		}
+	case RateLimitedError:
+		body["retry_after"] = int(err.RetryAfter.Seconds())
+	case UpstreamRateLimitedError:
+		body["retry_after"] = int(err.RetryAfter.Seconds())
+	case UpstreamError:
+		body["printful"] = gin.H{
+			"status": err.PrintfulStatus,
+			"code":   err.PrintfulCode,
+			"reason": err.PrintfulReason,
+		}
+	}
+
+	// The variants already changed when a change applied variant by variant fails
+	var partial printful.PartialUpdateError
+	if errors.As(e, &partial) {
+		body["updated_sync_variant_ids"] = partial.SyncVariantIDs
+	}
+
+	return apiErr, body
 }
 
 func jsonSuccess(c *gin.Context, data interface{}) {
-	c.JSON(http.StatusOK, gin.H{
+	c.JSON(http.StatusOK, successBody(data))
+}
+
+func successBody(data interface{}) gin.H {
+	return gin.H{
 		"success": true,
 		"result":  data,
-	})
+	}
 }
@@ -0,0 +1,205 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"printfulapi/src/model"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/mitchellh/mapstructure"
+)
+
+// paramsValidator checks the binding rules of the model request structs, reporting fields by their param name
+var paramsValidator = newParamsValidator()
+
+// mapstructure reports decoding errors as "'field' message"
+var decodeErrorPattern = regexp.MustCompile(`^'([^']*)' (.*)$`)
+
+func newParamsValidator() *validator.Validate {
+	v := validator.New()
+	v.SetTagName("binding")
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+		return name
+	})
+
+	v.RegisterValidation("webhook_event_type", oneOfValidator(model.WebhookEventTypes))
+	v.RegisterValidation("artwork_warning", oneOfValidator(model.ArtworkWarningCodes))
+	v.RegisterValidation("api_key_scope", oneOfValidator(model.ApiKeyScopes))
+
+	// schemas.Order has no binding tags, create-order needs its external id to be sent once
+	v.RegisterStructValidation(func(sl validator.StructLevel) {
+		if sl.Current().Interface().(model.CreateOrderRequest).Order.ExternalID == "" {
+			sl.ReportError("", "order.external_id", "ExternalID", "required", "")
+		}
+	}, model.CreateOrderRequest{})
+
+	return v
+}
+
+func oneOfValidator(values []string) validator.Func {
+	return func(fl validator.FieldLevel) bool {
+		value := fl.Field().String()
+		for _, v := range values {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// decodeParams fills request from the action params, applies the defaults and checks the binding rules.
+// Every bad parameter is listed in the returned ValidationError.
+func decodeParams(params map[string]interface{}, request interface{}) error {
+	fields := []FieldError{}
+	seen := make(map[string]bool)
+
+	err := mapstructure.Decode(params, request)
+	if err != nil {
+		var decodeErr *mapstructure.Error
+		if !errors.As(err, &decodeErr) {
+			slog.Error("unable to decode params", "error", err)
+			return ValidationError{Message: "Error while decoding params"}
+		}
+
+		for _, e := range decodeErr.Errors {
+			field := FieldError{Message: e}
+			if m := decodeErrorPattern.FindStringSubmatch(e); m != nil {
+				field = FieldError{Field: m[1], Message: m[2]}
+			}
+			fields = append(fields, field)
+			seen[field.Field] = true
+		}
+	}
+
+	setDefaults(reflect.ValueOf(request).Elem())
+
+	err = paramsValidator.Struct(request)
+	if err != nil {
+		var validationErrors validator.ValidationErrors
+		if !errors.As(err, &validationErrors) {
+			slog.Error("unable to validate params", "error", err)
+			return ValidationError{Message: "Error while validating params"}
+		}
+
+		for _, fe := range validationErrors {
+			name := paramName(fe.Namespace())
+			if seen[name] {
+				continue
+			}
+			fields = append(fields, FieldError{Field: name, Message: ruleMessage(fe)})
+			seen[name] = true
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+
+	problems := make([]string, 0, len(fields))
+	for _, field := range fields {
+		problems = append(problems, strings.TrimSpace(field.Field+" "+field.Message))
+	}
+
+	return ValidationError{Message: "invalid params: " + strings.Join(problems, ", "), Fields: fields}
+}
+
+// setDefaults sets the zero fields having a default tag, embedded structs included
+func setDefaults(v reflect.Value) {
+	if v.Kind() != reflect.Struct {
+		return
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		structField := v.Type().Field(i)
+
+		if structField.Anonymous {
+			setDefaults(field)
+			continue
+		}
+
+		def, ok := structField.Tag.Lookup("default")
+		if !ok || !field.IsZero() || !field.CanSet() {
+			continue
+		}
+
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(def)
+		case reflect.Int, reflect.Int64:
+			if n, err := strconv.ParseInt(def, 10, 64); err == nil {
+				field.SetInt(n)
+			}
+		case reflect.Bool:
+			field.SetBool(def == "true")
+		}
+	}
+}
+
+// paramName turns a validator namespace such as UpdateOrderRequest.OrderReference.order_id into order_id
+func paramName(namespace string) string {
+	parts := strings.Split(namespace, ".")[1:]
+	names := make([]string, 0, len(parts))
+	for _, part := range parts {
+		// Embedded structs have no param name and keep their Go name
+		if part != "" && unicode.IsUpper(rune(part[0])) {
+			continue
+		}
+		names = append(names, part)
+	}
+
+	return strings.Join(names, ".")
+}
+
+func ruleMessage(fe validator.FieldError) string {
+	sized := fe.Kind() == reflect.Slice || fe.Kind() == reflect.Map
+
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "required_without":
+		return "or " + snakeCase(fe.Param()) + " is required"
+	case "min":
+		if sized {
+			return fmt.Sprintf("must contain at least %s items", fe.Param())
+		}
+		return "must be at least " + fe.Param()
+	case "max":
+		if sized {
+			return fmt.Sprintf("must contain at most %s items", fe.Param())
+		}
+		return "must be at most " + fe.Param()
+	case "oneof":
+		return "must be one of " + fe.Param()
+	case "url":
+		return "must be a valid URL"
+	case "webhook_event_type":
+		return "must be one of " + strings.Join(model.WebhookEventTypes, " ")
+	case "artwork_warning":
+		return "must be one of " + strings.Join(model.ArtworkWarningCodes, " ")
+	case "api_key_scope":
+		return "must be one of " + strings.Join(model.ApiKeyScopes, " ")
+	}
+
+	return "is invalid (" + fe.Tag() + ")"
+}
+
+// snakeCase turns a Go field name such as ExternalID into external_id
+func snakeCase(name string) string {
+	b := strings.Builder{}
+	for i, r := range name {
+		if i > 0 && unicode.IsUpper(r) && unicode.IsLower(rune(name[i-1])) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
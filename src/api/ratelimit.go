@@ -0,0 +1,233 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"printfulapi/src/config"
+	"printfulapi/src/model"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Token bucket of the action classes missing from the configuration
+const DEFAULT_BUCKET_RATE = 1.0
+const DEFAULT_BUCKET_BURST = 20
+
+const DEFAULT_DAILY_QUOTA = 10000
+
+// Class of the actions any API key can call
+const ANY_ACTION_CLASS = config.ANY_ACTION_CLASS
+
+// Clients idle for longer are forgotten, their buckets would be full again anyway
+const RATE_LIMIT_IDLE = time.Hour
+
+// Limiter keeps a client from using more than its share of the Printful rate limit shared by every client.
+// Each client gets a token bucket per action class and a daily quota.
+type Limiter struct {
+	config  config.RateLimits
+	clients map[string]*clientUsage
+	pruned  time.Time
+	mutex   sync.Mutex
+	now     func() time.Time
+}
+
+type clientUsage struct {
+	day      string
+	requests int
+	buckets  map[string]*tokenBucket
+	lastSeen time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func NewLimiter(config config.RateLimits) *Limiter {
+	return &Limiter{
+		config:  config,
+		clients: make(map[string]*clientUsage),
+		now:     time.Now,
+	}
+}
+
+// SetConfig applies new limits, the clients keep their buckets and their count of the day
+func (l *Limiter) SetConfig(config config.RateLimits) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.config = config
+}
+
+// Allow counts an action of client, a RateLimitedError is returned when the bucket of the class is empty
+// or when the daily quota is exhausted
+func (l *Limiter) Allow(client string, class string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	l.prune(now)
+
+	usage := l.usage(client, now)
+	usage.lastSeen = now
+
+	quota := l.dailyQuota()
+	if quota >= 0 && usage.requests >= quota {
+		midnight := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+		return RateLimitedError{
+			Message:    fmt.Sprintf("daily quota of %d actions exceeded", quota),
+			RetryAfter: roundRetryAfter(midnight.Sub(now)),
+			Quota:      true,
+		}
+	}
+
+	rate, burst := l.bucketConfig(class)
+	bucket := usage.bucket(class, burst, now)
+	bucket.refill(rate, burst, now)
+	if bucket.tokens < 1 {
+		wait := time.Duration((1 - bucket.tokens) / rate * float64(time.Second))
+		return RateLimitedError{
+			Message:    "too many " + class + " actions",
+			RetryAfter: roundRetryAfter(wait),
+		}
+	}
+
+	bucket.tokens--
+	usage.requests++
+
+	return nil
+}
+
+// Usage returns the state of every known client, or of a single one when client is set
+func (l *Limiter) Usage(client string) []model.ClientUsage {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	result := []model.ClientUsage{}
+	for id, usage := range l.clients {
+		if client != "" && id != client {
+			continue
+		}
+
+		u := model.ClientUsage{
+			Client:     id,
+			Day:        usage.day,
+			Requests:   usage.requests,
+			DailyQuota: l.dailyQuota(),
+			Buckets:    make(map[string]float64),
+			LastSeen:   usage.lastSeen.Unix(),
+		}
+		if usage.day != usageDay(now) {
+			u.Day = usageDay(now)
+			u.Requests = 0
+		}
+		for class, bucket := range usage.buckets {
+			rate, burst := l.bucketConfig(class)
+			bucket.refill(rate, burst, now)
+			u.Buckets[class] = math.Floor(bucket.tokens*100) / 100
+		}
+		result = append(result, u)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Client < result[j].Client })
+
+	return result
+}
+
+func (l *Limiter) usage(client string, now time.Time) *clientUsage {
+	usage, ok := l.clients[client]
+	if !ok {
+		usage = &clientUsage{buckets: make(map[string]*tokenBucket)}
+		l.clients[client] = usage
+	}
+
+	if day := usageDay(now); usage.day != day {
+		usage.day = day
+		usage.requests = 0
+	}
+
+	return usage
+}
+
+func (l *Limiter) prune(now time.Time) {
+	if now.Sub(l.pruned) < RATE_LIMIT_IDLE {
+		return
+	}
+
+	for id, usage := range l.clients {
+		// The daily count of the client is kept until the day is over
+		if now.Sub(usage.lastSeen) > RATE_LIMIT_IDLE && usage.day != usageDay(now) {
+			delete(l.clients, id)
+		}
+	}
+	l.pruned = now
+}
+
+func (l *Limiter) dailyQuota() int {
+	if l.config.DailyQuota == 0 {
+		return DEFAULT_DAILY_QUOTA
+	}
+	return l.config.DailyQuota
+}
+
+func (l *Limiter) bucketConfig(class string) (float64, int) {
+	bucket := l.config.Classes[class]
+
+	rate, burst := bucket.Rate, bucket.Burst
+	if rate <= 0 {
+		rate = DEFAULT_BUCKET_RATE
+	}
+	if burst <= 0 {
+		burst = DEFAULT_BUCKET_BURST
+	}
+
+	return rate, burst
+}
+
+func (u *clientUsage) bucket(class string, burst int, now time.Time) *tokenBucket {
+	bucket, ok := u.buckets[class]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(burst), updated: now}
+		u.buckets[class] = bucket
+	}
+	return bucket
+}
+
+func (b *tokenBucket) refill(rate float64, burst int, now time.Time) {
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens = math.Min(float64(burst), b.tokens+elapsed.Seconds()*rate)
+		b.updated = now
+	}
+}
+
+func usageDay(now time.Time) string {
+	return now.UTC().Format("2006-01-02")
+}
+
+// roundRetryAfter rounds up to the second, Retry-After being sent in seconds
+func roundRetryAfter(d time.Duration) time.Duration {
+	rounded := d.Truncate(time.Second)
+	if rounded < d || rounded == 0 {
+		rounded += time.Second
+	}
+	return rounded
+}
+
+// actionClass returns the class an action is limited in
+func actionClass(scope string) string {
+	if scope == "" {
+		return ANY_ACTION_CLASS
+	}
+	return scope
+}
+
+// clientID identifies the caller by its API key, or by its IP when the API keys are disabled
+func clientID(c *gin.Context) string {
+	if value, ok := c.Get(API_KEY_CONTEXT); ok {
+		return "key:" + value.(*model.ApiKey).ID
+	}
+	return "ip:" + c.ClientIP()
+}
@@ -0,0 +1,20 @@
+package api
+
+import (
+	"errors"
+	"printfulapi/src/config"
+	"testing"
+)
+
+func TestLimiterReload(t *testing.T) {
+	limiter := NewLimiter(config.RateLimits{})
+	if err := limiter.Allow("client", ANY_ACTION_CLASS); err != nil {
+		t.Fatal(err)
+	}
+
+	limiter.SetConfig(config.RateLimits{DailyQuota: 1})
+	var limited RateLimitedError
+	if err := limiter.Allow("client", ANY_ACTION_CLASS); !errors.As(err, &limited) || !limited.Quota {
+		t.Errorf("the reloaded quota should apply, got %v", err)
+	}
+}
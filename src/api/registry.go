@@ -0,0 +1,127 @@
+package api
+
+import (
+	"context"
+	"printfulapi/src/model"
+	"sort"
+)
+
+// ActionFunc answers one version of an action, the result is sent back as is.
+// ctx ends when the client goes away or when the action timeout expires.
+type ActionFunc func(h *Handler, ctx context.Context, params map[string]interface{}) (interface{}, error)
+
+// Action is a registered version of an action
+type Action struct {
+	// Scope the API key needs, any key is accepted when empty
+	Scope string
+	Run   ActionFunc
+}
+
+type actionKey struct {
+	action  string
+	version int
+}
+
+// Registry maps an action and a version to its handler.
+// Several versions of an action can be registered, so that older clients keep the response shape they expect.
+type Registry struct {
+	actions map[actionKey]Action
+}
+
+func NewRegistry() *Registry {
+	return &Registry{actions: make(map[actionKey]Action)}
+}
+
+// Register adds a version of an action, it must be called before the handler serves requests
+func (r *Registry) Register(action string, version int, scope string, fn ActionFunc) {
+	r.actions[actionKey{action: action, version: version}] = Action{Scope: scope, Run: fn}
+}
+
+// Lookup returns the handler of an action version, a NotFoundError for an unknown action
+// and an UnsupportedVersionError for an unknown version
+func (r *Registry) Lookup(action string, version int) (*Action, error) {
+	if a, ok := r.actions[actionKey{action: action, version: version}]; ok {
+		return &a, nil
+	}
+
+	versions := r.Versions()[action]
+	if len(versions) == 0 {
+		return nil, NotFoundError{Message: "unknown action " + action}
+	}
+
+	return nil, UnsupportedVersionError{Action: action, Version: version, Supported: versions}
+}
+
+// Versions returns the supported versions of every action, in ascending order
+func (r *Registry) Versions() map[string][]int {
+	versions := make(map[string][]int)
+	for key := range r.actions {
+		versions[key.action] = append(versions[key.action], key.version)
+	}
+
+	for _, v := range versions {
+		sort.Ints(v)
+	}
+
+	return versions
+}
+
+func noParams(fn func(h *Handler, ctx context.Context) (interface{}, error)) ActionFunc {
+	return func(h *Handler, ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		return fn(h, ctx)
+	}
+}
+
+// defaultRegistry holds every action served by the API
+func defaultRegistry() *Registry {
+	r := NewRegistry()
+
+	r.Register("get-api-versions", 1, "", noParams((*Handler).getApiVersions))
+
+	r.Register("get-countries", 1, model.SCOPE_CATALOG_READ, noParams((*Handler).getCountries))
+	r.Register("get-products", 1, model.SCOPE_CATALOG_READ, noParams((*Handler).getProducts))
+	r.Register("get-product", 1, model.SCOPE_CATALOG_READ, (*Handler).getProduct)
+	r.Register("get-variant", 1, model.SCOPE_CATALOG_READ, (*Handler).getVariant)
+	r.Register("get-similar-variants", 1, model.SCOPE_CATALOG_READ, (*Handler).getSimilarVariants)
+	r.Register("get-templates", 1, model.SCOPE_CATALOG_READ, (*Handler).getTemplates)
+	r.Register("get-printfiles", 1, model.SCOPE_CATALOG_READ, (*Handler).getPrintfiles)
+
+	r.Register("upload-image", 1, model.SCOPE_SYNC_PRODUCT_WRITE, (*Handler).uploadImage)
+	r.Register("validate-artwork", 1, model.SCOPE_SYNC_PRODUCT_WRITE, (*Handler).validateArtwork)
+
+	r.Register("create-sync-product", 1, model.SCOPE_SYNC_PRODUCT_WRITE, (*Handler).createSyncProduct)
+	r.Register("get-sync-product", 1, model.SCOPE_CATALOG_READ, (*Handler).getSyncProduct)
+	r.Register("list-sync-products", 1, model.SCOPE_CATALOG_READ, (*Handler).listSyncProducts)
+	r.Register("modify-sync-product", 1, model.SCOPE_SYNC_PRODUCT_WRITE, (*Handler).modifySyncProduct)
+	r.Register("delete-sync-product", 1, model.SCOPE_SYNC_PRODUCT_WRITE, (*Handler).deleteSyncProduct)
+	r.Register("get-sync-variant", 1, model.SCOPE_CATALOG_READ, (*Handler).getSyncVariant)
+	r.Register("create-sync-variant", 1, model.SCOPE_SYNC_PRODUCT_WRITE, (*Handler).createSyncVariant)
+	r.Register("modify-sync-variant", 1, model.SCOPE_SYNC_PRODUCT_WRITE, (*Handler).modifySyncVariant)
+	r.Register("delete-sync-variant", 1, model.SCOPE_SYNC_PRODUCT_WRITE, (*Handler).deleteSyncVariant)
+
+	r.Register("calculate-shipping-rates", 1, model.SCOPE_PRICING, (*Handler).calculateShippingRates)
+	r.Register("calculate-tax-rate", 1, model.SCOPE_PRICING, (*Handler).calculateTaxRate)
+
+	r.Register("create-order", 1, model.SCOPE_ORDER_WRITE, (*Handler).createOrder)
+	r.Register("get-order", 1, model.SCOPE_ORDER_WRITE, (*Handler).getOrder)
+	r.Register("list-orders", 1, model.SCOPE_ORDER_WRITE, (*Handler).listOrders)
+	r.Register("update-order", 1, model.SCOPE_ORDER_WRITE, (*Handler).updateOrder)
+	r.Register("confirm-order", 1, model.SCOPE_ORDER_WRITE, (*Handler).confirmOrder)
+	r.Register("cancel-order", 1, model.SCOPE_ORDER_WRITE, (*Handler).cancelOrder)
+	r.Register("estimate-order-costs", 1, model.SCOPE_PRICING, (*Handler).estimateOrderCosts)
+
+	r.Register("get-webhooks", 1, model.SCOPE_ADMIN, noParams((*Handler).getWebhooks))
+	r.Register("set-webhooks", 1, model.SCOPE_ADMIN, (*Handler).setWebhooks)
+	r.Register("disable-webhooks", 1, model.SCOPE_ADMIN, noParams((*Handler).disableWebhooks))
+
+	r.Register("create-mockup-task", 1, model.SCOPE_CATALOG_READ, (*Handler).createMockupTask)
+	r.Register("get-mockup-task", 1, model.SCOPE_CATALOG_READ, (*Handler).getMockupTask)
+
+	r.Register("create-api-key", 1, model.SCOPE_ADMIN, (*Handler).createApiKey)
+	r.Register("revoke-api-key", 1, model.SCOPE_ADMIN, (*Handler).revokeApiKey)
+	r.Register("list-api-keys", 1, model.SCOPE_ADMIN, noParams((*Handler).listApiKeys))
+	r.Register("get-usage", 1, model.SCOPE_ADMIN, (*Handler).getUsage)
+	r.Register("get-diagnostics", 1, model.SCOPE_ADMIN, noParams((*Handler).getDiagnostics))
+
+	return r
+}
@@ -1,5 +1,7 @@
 package config
 
+// Config is read by Load, which documents the environment variables overriding it.
+// Unset settings keep the default given in their comment, the settings applied on SIGHUP are listed by Reload.
 type Config struct {
 	HTTP      HTTP `json:"http"`
 	Databases struct {
@@ -7,25 +9,107 @@ type Config struct {
 		Images   Database `json:"images"`
 	} `json:"databases"`
 	Printful Printful `json:"printful"`
+	API      API      `json:"api"`
+	Logging  Logging  `json:"logging"`
+}
+
+type Logging struct {
+	// debug, info, warn or error, info by default
+	Level string `json:"level"`
+	// text or json, text by default
+	Format string `json:"format"`
+	// Log the tokens, URIs credentials and customer data instead of redacting them
+	ShowSensitive bool `json:"show_sensitive"`
 }
 
 type HTTP struct {
-	Port          int    `json:"port"`
+	// Port served over HTTPS, required
+	Port int `json:"port"`
+	// Key and certificate files of the server, required
 	HttpsKeyFile  string `json:"https_key_file"`
 	HttpsCertFile string `json:"https_cert_file"`
+	// Seconds given to the requests in flight, the workers and the databases to finish on SIGINT or SIGTERM
+	ShutdownTimeout int `json:"shutdown_timeout"`
 }
 
 type Database struct {
+	// Required, PRINTFUL_DB_URI and IMAGES_DB_URI override it
 	ConnectURI string `json:"connect_uri"`
-	DBName     string `json:"db_name"`
+	// Required
+	DBName string `json:"db_name"`
+	// GridFS bucket of the images database, required there
 	BucketName string `json:"bucket_name"`
+	// Seconds a query may take, 5 when unset
+	Timeout int `json:"timeout"`
+	// Seconds the products and variants cached in the printful database are served before being fetched again, 86400 when unset
+	CacheTTL int `json:"cache_ttl"`
 }
 
 type Printful struct {
-	AccessToken     string `json:"access_token"`
+	// Required, PRINTFUL_ACCESS_TOKEN overrides it
+	AccessToken string `json:"access_token"`
+	// Needed by tokens giving access to several stores, PRINTFUL_STORE_ID overrides it
+	StoreID string `json:"store_id"`
+	// https://api.printful.com when unset
+	BaseURL string `json:"base_url"`
+	// Seconds a call to Printful may take, rate limit waits included, 30 when unset
+	CallTimeout int   `json:"call_timeout"`
+	Retry       Retry `json:"retry"`
+	// Seconds the catalog product list is kept before being fetched again, 43200 when unset
+	CatalogTTL int `json:"catalog_ttl"`
+	// Answer the mockup tasks with the task SimulateTaskKey instead of creating new ones
 	SimulateMockup  bool   `json:"simulate_mockup"`
 	SimulateTaskKey string `json:"simulate_task_key"`
-	TaskInterval    int    `json:"task_interval"`
+	// Milliseconds between two polls of a pending mockup task, 10000 when unset
+	TaskInterval int `json:"task_interval"`
+	// Directory the generated mockups are written to, they go to the images database when unset
 	MockupDirectory string `json:"mockup_directory"`
-	ImagesURL       string `json:"images_url"`
+	// Public URL of the images served from the images database, required
+	ImagesURL string `json:"images_url"`
+	// Secret expected in the URL of the webhooks, PRINTFUL_WEBHOOK_SECRET overrides it
+	WebhookSecret string `json:"webhook_secret"`
+}
+
+type API struct {
+	// Keys defined here can't be revoked by the admin actions
+	Keys       []APIKey   `json:"keys"`
+	RateLimits RateLimits `json:"rate_limits"`
+	// Seconds an action may take, 60 when unset
+	ActionTimeout int `json:"action_timeout"`
+}
+
+// RateLimits applies to each API key, or to each IP when the API keys are disabled
+type RateLimits struct {
+	// Token buckets keyed by action class, which is the scope of the action ("any" for the actions any key can call)
+	Classes map[string]Bucket `json:"classes"`
+	// Actions allowed per UTC day, 10000 when unset, negative to disable the quota
+	DailyQuota int `json:"daily_quota"`
+}
+
+// Bucket holds up to Burst tokens and refills at Rate tokens per second, 1 and 20 when unset
+type Bucket struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+type APIKey struct {
+	// Required and unique, API_KEY_<NAME> overrides the key
+	Name string `json:"name"`
+	// Keys left empty are ignored
+	Key    string   `json:"key"`
+	Scopes []string `json:"scopes"`
+	// Origins allowed to use the key from a browser, none when empty
+	AllowedOrigins []string `json:"allowed_origins"`
+}
+
+// Retry of the Printful calls failing with a 5xx or a network error, unset fields keep their default
+type Retry struct {
+	// Attempts of a call, the first one included, 3 by default
+	MaxAttempts int `json:"max_attempts"`
+	// Milliseconds before the first retry, doubled for each of the next ones, 250 by default
+	BaseDelay int `json:"base_delay"`
+	// Milliseconds between two retries at most, 5000 by default
+	MaxDelay int `json:"max_delay"`
+	// Retries earned by each call, 0.1 by default
+	Budget float64 `json:"budget"`
 }
@@ -0,0 +1,237 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"printfulapi/src/model"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Configuration file read when no path is given
+const DEFAULT_PATH = "config.json"
+
+// Rate limit class of the actions any API key can call
+const ANY_ACTION_CLASS = "any"
+
+// Prefix of the variables setting the key of a configured API key, API_KEY_STOREFRONT for the key named storefront
+const API_KEY_ENV_PREFIX = "API_KEY_"
+
+// Environment variables overriding the configuration file, for the secrets better kept out of it
+var envOverrides = []struct {
+	name string
+	set  func(c *Config, value string)
+}{
+	{"PRINTFUL_ACCESS_TOKEN", func(c *Config, value string) { c.Printful.AccessToken = value }},
+	{"PRINTFUL_STORE_ID", func(c *Config, value string) { c.Printful.StoreID = value }},
+	{"PRINTFUL_WEBHOOK_SECRET", func(c *Config, value string) { c.Printful.WebhookSecret = value }},
+	{"PRINTFUL_DB_URI", func(c *Config, value string) { c.Databases.Printful.ConnectURI = value }},
+	{"IMAGES_DB_URI", func(c *Config, value string) { c.Databases.Images.ConnectURI = value }},
+	{"LOG_LEVEL", func(c *Config, value string) { c.Logging.Level = value }},
+}
+
+// ValidationError lists every problem found in a configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (e ValidationError) Error() string {
+	return "invalid configuration: " + strings.Join(e.Problems, ", ")
+}
+
+// Load reads the configuration file at path, applies the environment overrides and validates the result.
+// Keys the configuration doesn't know are refused, so that a misspelled setting doesn't silently keep its default.
+func Load(path string) (*Config, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read configuration: %w", err)
+	}
+
+	config := &Config{}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(config); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %s", path, describeDecodeError(content, err))
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("unable to parse %s: unexpected content after the configuration", path)
+	}
+
+	applyEnv(config, os.LookupEnv)
+
+	if err = config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+func applyEnv(config *Config, lookup func(string) (string, bool)) {
+	for _, override := range envOverrides {
+		if value, ok := lookup(override.name); ok {
+			override.set(config, value)
+		}
+	}
+
+	for i, key := range config.API.Keys {
+		if value, ok := lookup(apiKeyEnv(key.Name)); ok {
+			config.API.Keys[i].Key = value
+		}
+	}
+}
+
+func apiKeyEnv(name string) string {
+	return API_KEY_ENV_PREFIX + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_", " ", "_").Replace(name))
+}
+
+// describeDecodeError adds the line of the problem to the errors of encoding/json
+func describeDecodeError(content []byte, err error) string {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return fmt.Sprintf("line %d: %s", lineOf(content, syntaxErr.Offset), syntaxErr.Error())
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return fmt.Sprintf("line %d: %s must be a %s, not a %s", lineOf(content, typeErr.Offset), typeErr.Field, typeErr.Type, typeErr.Value)
+	}
+
+	// Unknown keys are only reported by name
+	if name, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return "unknown key " + name
+	}
+
+	return err.Error()
+}
+
+func lineOf(content []byte, offset int64) int {
+	if offset > int64(len(content)) {
+		offset = int64(len(content))
+	}
+	return bytes.Count(content[:offset], []byte("\n")) + 1
+}
+
+// Validate checks the settings are usable, every problem is listed in the returned ValidationError
+func (c *Config) Validate() error {
+	v := validation{}
+
+	v.check(c.HTTP.Port > 0 && c.HTTP.Port <= 65535, "http.port must be between 1 and 65535")
+	v.required(c.HTTP.HttpsKeyFile, "http.https_key_file")
+	v.required(c.HTTP.HttpsCertFile, "http.https_cert_file")
+	v.notNegative(c.HTTP.ShutdownTimeout, "http.shutdown_timeout")
+
+	v.database(c.Databases.Printful, "databases.printful")
+	v.database(c.Databases.Images, "databases.images")
+	v.required(c.Databases.Images.BucketName, "databases.images.bucket_name")
+	v.notNegative(c.Databases.Printful.CacheTTL, "databases.printful.cache_ttl")
+
+	v.check(c.Printful.AccessToken != "", "printful.access_token is required, or PRINTFUL_ACCESS_TOKEN")
+	if c.Printful.BaseURL != "" {
+		v.url(c.Printful.BaseURL, "printful.base_url")
+	}
+	v.url(c.Printful.ImagesURL, "printful.images_url")
+	v.notNegative(c.Printful.CallTimeout, "printful.call_timeout")
+	v.notNegative(c.Printful.CatalogTTL, "printful.catalog_ttl")
+	v.notNegative(c.Printful.TaskInterval, "printful.task_interval")
+	if c.Printful.SimulateMockup {
+		v.check(c.Printful.SimulateTaskKey != "", "printful.simulate_task_key is required when printful.simulate_mockup is set")
+	}
+	v.notNegative(c.Printful.Retry.MaxAttempts, "printful.retry.max_attempts")
+	v.notNegative(c.Printful.Retry.BaseDelay, "printful.retry.base_delay")
+	v.notNegative(c.Printful.Retry.MaxDelay, "printful.retry.max_delay")
+	v.check(c.Printful.Retry.Budget >= 0, "printful.retry.budget must not be negative")
+	if c.Printful.Retry.BaseDelay > 0 && c.Printful.Retry.MaxDelay > 0 {
+		v.check(c.Printful.Retry.BaseDelay <= c.Printful.Retry.MaxDelay, "printful.retry.base_delay must not exceed printful.retry.max_delay")
+	}
+
+	names := make(map[string]bool)
+	for i, key := range c.API.Keys {
+		field := fmt.Sprintf("api.keys[%d]", i)
+		v.required(key.Name, field+".name")
+		v.check(!names[key.Name], field+".name "+key.Name+" is used by another key")
+		names[key.Name] = true
+		for _, scope := range key.Scopes {
+			v.check(containsString(model.ApiKeyScopes, scope), field+".scopes must be among "+strings.Join(model.ApiKeyScopes, " ")+", not "+scope)
+		}
+	}
+	classes := make([]string, 0, len(c.API.RateLimits.Classes))
+	for class := range c.API.RateLimits.Classes {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	for _, class := range classes {
+		bucket := c.API.RateLimits.Classes[class]
+		field := "api.rate_limits.classes." + class
+		v.check(class == ANY_ACTION_CLASS || containsString(model.ApiKeyScopes, class), field+" is not an action class")
+		v.check(bucket.Rate >= 0, field+".rate must not be negative")
+		v.notNegative(bucket.Burst, field+".burst")
+	}
+	v.notNegative(c.API.ActionTimeout, "api.action_timeout")
+
+	v.check(containsString([]string{"", "debug", "info", "warn", "error"}, strings.ToLower(c.Logging.Level)), "logging.level must be one of debug info warn error")
+	v.check(containsString([]string{"", "text", "json"}, strings.ToLower(c.Logging.Format)), "logging.format must be one of text json")
+
+	if len(v.problems) == 0 {
+		return nil
+	}
+
+	return ValidationError{Problems: v.problems}
+}
+
+type validation struct {
+	problems []string
+}
+
+func (v *validation) check(ok bool, problem string) {
+	if !ok {
+		v.problems = append(v.problems, problem)
+	}
+}
+
+func (v *validation) required(value string, field string) {
+	v.check(value != "", field+" is required")
+}
+
+func (v *validation) notNegative(value int, field string) {
+	v.check(value >= 0, field+" must not be negative")
+}
+
+func (v *validation) database(db Database, field string) {
+	v.required(db.ConnectURI, field+".connect_uri")
+	v.required(db.DBName, field+".db_name")
+	v.notNegative(db.Timeout, field+".timeout")
+}
+
+func (v *validation) url(value string, field string) {
+	u, err := url.Parse(value)
+	v.check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", field+" must be an http or https URL")
+}
+
+// Reload returns next with the settings a reload can't apply kept from c, and whether any of them differed.
+// Rate limits, the Printful call timeout, retries and catalog TTL, the product cache TTL and the log level
+// are applied on SIGHUP, anything else needs a restart.
+func (c Config) Reload(next Config) (Config, bool) {
+	reloaded := c
+	reloaded.API.RateLimits = next.API.RateLimits
+	reloaded.Printful.CallTimeout = next.Printful.CallTimeout
+	reloaded.Printful.Retry = next.Printful.Retry
+	reloaded.Printful.CatalogTTL = next.Printful.CatalogTTL
+	reloaded.Databases.Printful.CacheTTL = next.Databases.Printful.CacheTTL
+	reloaded.Logging.Level = next.Logging.Level
+
+	return reloaded, !reflect.DeepEqual(reloaded, next)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
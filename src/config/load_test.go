@@ -0,0 +1,67 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	t.Setenv("PRINTFUL_ACCESS_TOKEN", "token-from-env")
+	t.Setenv("API_KEY_STOREFRONT", "storefront-key")
+
+	example, err := Load("../../config_example.json")
+	if err != nil {
+		t.Fatalf("the example configuration should load, got %s", err)
+	}
+	if example.Printful.AccessToken != "token-from-env" || example.API.Keys[0].Key != "storefront-key" {
+		t.Errorf("the environment should override the file, got %q and %q", example.Printful.AccessToken, example.API.Keys[0].Key)
+	}
+	if !example.Printful.SimulateMockup || example.Printful.TaskInterval != 20000 || example.Printful.MockupDirectory == "" {
+		t.Errorf("the mockup settings should be read, got %+v", example.Printful)
+	}
+
+	write := func(content string) string {
+		path := filepath.Join(t.TempDir(), "config.json")
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	_, err = Load(write(`{"printful": {"simulateMockup": true}}`))
+	if err == nil || !strings.Contains(err.Error(), `unknown key "simulateMockup"`) {
+		t.Errorf("an unknown key should be refused, got %v", err)
+	}
+
+	_, err = Load(write("{\n\t\"http\": {\"port\": \"443\"}\n}"))
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("a type error should give its line, got %v", err)
+	}
+
+	_, err = Load(write(`{"http": {"port": 70000}, "printful": {"retry": {"max_attempts": -1}, "simulate_mockup": true}, "logging": {"level": "verbose"}}`))
+	var validation ValidationError
+	if !errors.As(err, &validation) {
+		t.Fatalf("an invalid configuration should be refused, got %v", err)
+	}
+	for _, problem := range []string{"http.port must be between 1 and 65535", "databases.images.bucket_name is required", "printful.retry.max_attempts must not be negative", "printful.simulate_task_key is required when printful.simulate_mockup is set", "logging.level must be one of debug info warn error"} {
+		if !containsString(validation.Problems, problem) {
+			t.Errorf("the problems should list %q, got %v", problem, validation.Problems)
+		}
+	}
+
+	next := *example
+	next.API.RateLimits = RateLimits{DailyQuota: 1}
+	next.Printful.CallTimeout = 10
+	next.Databases.Printful.CacheTTL = 3600
+	reloaded, restart := example.Reload(next)
+	if restart || reloaded.API.RateLimits.DailyQuota != 1 || reloaded.Printful.CallTimeout != 10 || reloaded.Databases.Printful.CacheTTL != 3600 {
+		t.Errorf("rate limits and timeouts should be reloaded, got %+v, restart %t", reloaded.API.RateLimits, restart)
+	}
+	next.HTTP.Port = 8443
+	if reloaded, restart = example.Reload(next); !restart || reloaded.HTTP.Port != example.HTTP.Port {
+		t.Errorf("a port change should need a restart, got %d, restart %t", reloaded.HTTP.Port, restart)
+	}
+}
@@ -0,0 +1,81 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"printfulapi/src/config"
+	"strings"
+)
+
+// Level used when the configuration doesn't set one
+const DEFAULT_LEVEL = "info"
+
+// Level of the handler installed by Setup, SetLevel changes it
+var level = &slog.LevelVar{}
+
+// Setup makes slog, and the log package through it, write with the configured level and format.
+// Sensitive values are redacted unless the configuration shows them.
+func Setup(config config.Logging) {
+	level.Set(parseLevel(config.Level))
+	slog.SetDefault(slog.New(newHandler(os.Stderr, config, level)))
+}
+
+// SetLevel changes the level of the handler installed by Setup
+func SetLevel(l string) {
+	level.Set(parseLevel(l))
+}
+
+// NewHandler returns a handler like the one Setup installs, writing to w
+func NewHandler(w io.Writer, config config.Logging) slog.Handler {
+	return newHandler(w, config, parseLevel(config.Level))
+}
+
+func newHandler(w io.Writer, config config.Logging, leveler slog.Leveler) slog.Handler {
+	opts := &slog.HandlerOptions{Level: leveler}
+	if !config.ShowSensitive {
+		opts.ReplaceAttr = redactAttr
+	}
+
+	var handler slog.Handler
+	if strings.EqualFold(config.Format, "json") {
+		handler = slog.NewJSONHandler(w, opts)
+	} else {
+		handler = slog.NewTextHandler(w, opts)
+	}
+
+	return contextHandler{handler}
+}
+
+func parseLevel(level string) slog.Level {
+	if level == "" {
+		level = DEFAULT_LEVEL
+	}
+
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return slog.LevelInfo
+	}
+	return l
+}
+
+// contextHandler adds the request id of the context to the records
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String(REQUEST_ID_ATTR, id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,68 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Header carrying the request id, sent by the client or generated, and echoed in the response
+const REQUEST_ID_HEADER = "Request-Id"
+
+// Attribute of the request id in the log records
+const REQUEST_ID_ATTR = "request_id"
+
+// Request ids sent by clients are kept only when they are this safe to log
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+type requestIDKey struct{}
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request id of ctx, empty outside of a request
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Middleware attaches the request id to the request context and to the response, then logs the request once served
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(REQUEST_ID_HEADER)
+		if !requestIDPattern.MatchString(id) {
+			id = newRequestID()
+		}
+
+		ctx := WithRequestID(c.Request.Context(), id)
+		c.Request = c.Request.WithContext(ctx)
+		c.Header(REQUEST_ID_HEADER, id)
+
+		start := time.Now()
+		c.Next()
+
+		level := slog.LevelInfo
+		if c.Writer.Status() >= 500 {
+			level = slog.LevelError
+		}
+		// The query is left out, it may carry secrets
+		slog.Log(ctx, level, "request served",
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status", c.Writer.Status(),
+			"duration", time.Since(start),
+		)
+	}
+}
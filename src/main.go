@@ -1,28 +1,149 @@
 package main
 
 import (
-	"encoding/json"
-	"log"
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
 	"os"
+	"os/signal"
+	"printfulapi/src/api"
 	"printfulapi/src/config"
+	"printfulapi/src/logging"
 	"printfulapi/src/mongo"
 	"printfulapi/src/printful"
 	"printfulapi/src/server"
+	"printfulapi/src/webhooks"
+	"syscall"
+	"time"
 )
 
 func main() {
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
-	config := config.Config{}
-	if content, err := os.ReadFile("config.json"); err == nil {
-		if err = json.Unmarshal(content, &config); err == nil {
-			printful.SetPrintfulConfig(config.Printful)
-			mongo.InitPrintfulDB(config.Databases.Printful)
-			mongo.InitImagesDB(config.Databases.Images)
-			server.StartServer(config.HTTP)
-		} else {
-			log.Println("Error while reading configuration", err)
+	configPath := flag.String("config", config.DEFAULT_PATH, "path of the configuration file")
+	flag.Parse()
+
+	config, err := config.Load(*configPath)
+	if err != nil {
+		slog.Error("unable to load the configuration", "path", *configPath, "error", err)
+		os.Exit(1)
+	}
+
+	logging.Setup(config.Logging)
+	if err = run(*configPath, *config); err != nil {
+		slog.Error("server stopped", "error", err)
+		os.Exit(1)
+	}
+}
+
+// run serves until SIGINT or SIGTERM, then lets the requests in flight, the workers and the databases finish
+// within the shutdown timeout. The configuration at configPath is reloaded on SIGHUP.
+func run(configPath string, config config.Config) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	mongo.InitPrintfulDB(config.Databases.Printful)
+	mongo.InitImagesDB(config.Databases.Images)
+	client := printful.NewClient(
+		printful.WithConfig(config.Printful),
+		printful.WithCache(mongo.ProductCache{}),
+		printful.WithImageStore(mongo.ImageStore{}),
+		printful.WithOrderSubmissionStore(mongo.OrderSubmissionStore{}),
+	)
+	client.WarmUp()
+	receiver := webhooks.NewReceiver(config.Printful.WebhookSecret, mongo.WebhookEventStore{})
+	auth := api.NewAuthenticator(config.API.Keys, mongo.ApiKeyStore{})
+	limiter := api.NewLimiter(config.API.RateLimits)
+	handlerOptions := []api.HandlerOption{
+		api.WithAuthenticator(auth),
+		api.WithLimiter(limiter),
+	}
+	if config.API.ActionTimeout > 0 {
+		handlerOptions = append(handlerOptions, api.WithActionTimeout(time.Duration(config.API.ActionTimeout)*time.Second))
+	}
+	health := api.NewHealth()
+	health.Register("mongo_printful", mongo.PingPrintfulDB)
+	health.Register("mongo_images", mongo.PingImagesDB)
+	health.Register("warm_up", func(ctx context.Context) error {
+		if !client.WarmedUp() {
+			return errors.New("catalog warm-up in progress")
 		}
-	} else {
-		log.Println("Error while reading configuration file", err)
+		return nil
+	})
+	health.Register("printful", client.Ping)
+	srv := server.NewServer(config.HTTP, api.NewHandler(client, handlerOptions...), auth, receiver, health)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Start()
+	}()
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	go func() {
+		current := config
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hangup:
+				current = reload(configPath, current, limiter, client)
+			}
+		}
+	}()
+
+	var err error
+	select {
+	case <-ctx.Done():
+		slog.Info("shutting down")
+	case err = <-serveErr:
+	}
+	// A second signal kills the process
+	stop()
+
+	shutdownTimeout := server.DEFAULT_SHUTDOWN_TIMEOUT
+	if config.HTTP.ShutdownTimeout > 0 {
+		shutdownTimeout = time.Duration(config.HTTP.ShutdownTimeout) * time.Second
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// Requests first, as they use the workers and the databases
+	if e := srv.Shutdown(shutdownCtx); e != nil {
+		slog.Warn("requests still in flight were cut", "error", e)
+	}
+	if e := receiver.Wait(shutdownCtx); e != nil {
+		slog.Warn("webhook handlers still running were abandoned", "error", e)
+	}
+	if e := client.Close(shutdownCtx); e != nil {
+		slog.Warn("background tasks still running were abandoned", "error", e)
+	}
+	if e := mongo.Disconnect(shutdownCtx); e != nil {
+		slog.Error("unable to disconnect from the databases", "error", e)
+	}
+
+	return err
+}
+
+// reload applies the settings of the configuration file which don't need a restart, and returns the configuration
+// now in use. The current configuration is kept when the file is not valid.
+func reload(configPath string, current config.Config, limiter *api.Limiter, client *printful.Client) config.Config {
+	next, err := config.Load(configPath)
+	if err != nil {
+		slog.Error("configuration not reloaded", "path", configPath, "error", err)
+		return current
 	}
+
+	reloaded, restart := current.Reload(*next)
+	limiter.SetConfig(reloaded.API.RateLimits)
+	client.Reload(reloaded.Printful)
+	mongo.SetCacheMaxAge(reloaded.Databases.Printful.CacheTTL)
+	logging.SetLevel(reloaded.Logging.Level)
+
+	slog.Info("configuration reloaded", "path", configPath)
+	if restart {
+		slog.Warn("only the rate limits, the printful call timeout, retries and catalog ttl, the product cache ttl and the log level were reloaded, other changes need a restart")
+	}
+
+	return reloaded
 }
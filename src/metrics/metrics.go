@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const NAMESPACE = "printfulapi"
+
+// Label of the actions which are not registered, so that clients can't create series at will
+const UNKNOWN_ACTION = "unknown"
+
+// Status label of the Printful calls which got no reply
+const NO_REPLY = "no_reply"
+
+// Registry holds the metrics served on /metrics
+var Registry = newRegistry()
+
+var factory = promauto.With(Registry)
+
+var ActionRequests = factory.NewCounterVec(prometheus.CounterOpts{
+	Namespace: NAMESPACE,
+	Name:      "action_requests_total",
+	Help:      "Actions called, by action.",
+}, []string{"action"})
+
+var ActionErrors = factory.NewCounterVec(prometheus.CounterOpts{
+	Namespace: NAMESPACE,
+	Name:      "action_errors_total",
+	Help:      "Actions which failed, by action and error code.",
+}, []string{"action", "code"})
+
+var ActionDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: NAMESPACE,
+	Name:      "action_duration_seconds",
+	Help:      "Time taken by the actions, by action.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"action"})
+
+var PrintfulRequests = factory.NewCounterVec(prometheus.CounterOpts{
+	Namespace: NAMESPACE,
+	Name:      "printful_requests_total",
+	Help:      "Calls sent to Printful, retries included, by endpoint group and HTTP status.",
+}, []string{"endpoint", "status"})
+
+var PrintfulDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: NAMESPACE,
+	Name:      "printful_request_duration_seconds",
+	Help:      "Time Printful took to answer a call, by endpoint group.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"endpoint"})
+
+var PrintfulRateLimited = factory.NewCounterVec(prometheus.CounterOpts{
+	Namespace: NAMESPACE,
+	Name:      "printful_rate_limited_total",
+	Help:      "Calls Printful answered with 429, by endpoint group.",
+}, []string{"endpoint"})
+
+var PrintfulRateLimitWait = factory.NewCounterVec(prometheus.CounterOpts{
+	Namespace: NAMESPACE,
+	Name:      "printful_rate_limit_wait_seconds_total",
+	Help:      "Time calls spent waiting for the Printful rate limit, by endpoint group.",
+}, []string{"endpoint"})
+
+var CacheLookups = factory.NewCounterVec(prometheus.CounterOpts{
+	Namespace: NAMESPACE,
+	Name:      "cache_lookups_total",
+	Help:      "Lookups in the product and variant cache, by kind and result: hit, miss or stale.",
+}, []string{"kind", "result"})
+
+var GridFSUploads = factory.NewCounter(prometheus.CounterOpts{
+	Namespace: NAMESPACE,
+	Name:      "gridfs_uploads_total",
+	Help:      "Files uploaded to the images bucket.",
+})
+
+var GridFSUploadBytes = factory.NewCounter(prometheus.CounterOpts{
+	Namespace: NAMESPACE,
+	Name:      "gridfs_upload_bytes_total",
+	Help:      "Bytes uploaded to the images bucket.",
+})
+
+func newRegistry() *prometheus.Registry {
+	r := prometheus.NewRegistry()
+	r.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	return r
+}
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Since returns the seconds elapsed since start, as observed by the histograms
+func Since(start time.Time) float64 {
+	return time.Since(start).Seconds()
+}
@@ -0,0 +1,61 @@
+package model
+
+// Read the catalog, templates, printfiles, mockups and sync products
+const SCOPE_CATALOG_READ = "catalog-read"
+
+// Calculate shipping rates, tax rates and order costs
+const SCOPE_PRICING = "pricing"
+
+// Upload designs and create, modify or delete sync products
+const SCOPE_SYNC_PRODUCT_WRITE = "sync-product-write"
+
+// Create, read and manage orders
+const SCOPE_ORDER_WRITE = "order-write"
+
+// Manage API keys and webhooks
+const SCOPE_ADMIN = "admin"
+
+var ApiKeyScopes = []string{
+	SCOPE_CATALOG_READ,
+	SCOPE_PRICING,
+	SCOPE_SYNC_PRODUCT_WRITE,
+	SCOPE_ORDER_WRITE,
+	SCOPE_ADMIN,
+}
+
+// ApiKey identifies a client of the API, only a hash of the key itself is kept
+type ApiKey struct {
+	ID     string   `json:"id" bson:"id"`
+	Name   string   `json:"name" bson:"name"`
+	Hash   string   `json:"-" bson:"hash"`
+	Scopes []string `json:"scopes" bson:"scopes"`
+	// Origins allowed to use the key from a browser, the key can't be used from a browser when empty
+	AllowedOrigins []string `json:"allowed_origins" bson:"allowed_origins"`
+	Created        int64    `json:"created" bson:"created"`
+	Revoked        bool     `json:"revoked" bson:"revoked"`
+}
+
+func (k *ApiKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// CreatedApiKey is returned once, when the key is created
+type CreatedApiKey struct {
+	ApiKey
+	Key string `json:"key"`
+}
+
+type CreateApiKeyRequest struct {
+	Name           string   `mapstructure:"name" binding:"required"`
+	Scopes         []string `mapstructure:"scopes" binding:"required,min=1,dive,api_key_scope"`
+	AllowedOrigins []string `mapstructure:"allowed_origins" binding:"dive,url"`
+}
+
+type RevokeApiKeyRequest struct {
+	ID string `mapstructure:"id" binding:"required"`
+}
@@ -0,0 +1,61 @@
+package model
+
+import "github.com/baldurstod/printful-api-model/schemas"
+
+// The design has fewer pixels than the printfile needs at its DPI
+const ARTWORK_LOW_DPI = "low_dpi"
+
+// The aspect ratio differs from the print area, blank bands will be added
+const ARTWORK_LETTERBOXING = "letterboxing"
+
+// The aspect ratio differs from the print area, the design will be cropped
+const ARTWORK_CROPPING = "cropping"
+
+// The design has transparent pixels, the product color will show through
+const ARTWORK_TRANSPARENCY = "transparency"
+
+var ArtworkWarningCodes = []string{
+	ARTWORK_LOW_DPI,
+	ARTWORK_LETTERBOXING,
+	ARTWORK_CROPPING,
+	ARTWORK_TRANSPARENCY,
+}
+
+type ArtworkWarning struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ArtworkReport is the print-readiness of one file on one variant
+type ArtworkReport struct {
+	Placement       string           `json:"placement"`
+	VariantID       int              `json:"variant_id"`
+	PrintfileID     int              `json:"printfile_id"`
+	PrintfileWidth  int              `json:"printfile_width"`
+	PrintfileHeight int              `json:"printfile_height"`
+	PrintfileDPI    int              `json:"printfile_dpi"`
+	ImageWidth      int              `json:"image_width"`
+	ImageHeight     int              `json:"image_height"`
+	EffectiveDPI    int              `json:"effective_dpi"`
+	Warnings        []ArtworkWarning `json:"warnings"`
+}
+
+type ArtworkValidation struct {
+	// False when a warning listed in Reject was raised
+	Ready   bool            `json:"ready"`
+	Reports []ArtworkReport `json:"reports"`
+}
+
+type ValidateArtworkRequest struct {
+	ProductID  int               `mapstructure:"product_id" binding:"required,min=1"`
+	VariantIDs []int             `mapstructure:"variant_ids" binding:"required,min=1,dive,min=1"`
+	Files      []SyncProductFile `mapstructure:"files" binding:"required,min=1"`
+	// Warning codes making the artwork not ready to print
+	Reject []string `mapstructure:"reject" binding:"dive,artwork_warning"`
+}
+
+// CreatedSyncProduct is a sync product along with the artwork warnings raised while creating it
+type CreatedSyncProduct struct {
+	schemas.SyncProduct
+	ArtworkWarnings []ArtworkReport `json:"artwork_warnings,omitempty"`
+}
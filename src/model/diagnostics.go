@@ -0,0 +1,58 @@
+package model
+
+// Readiness tells whether the service can take requests, with the result of each check
+type Readiness struct {
+	Ready   bool          `json:"ready"`
+	Checked int64         `json:"checked"`
+	Checks  []HealthCheck `json:"checks"`
+}
+
+type HealthCheck struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+	// Milliseconds the check took
+	Duration int64 `json:"duration"`
+}
+
+// Diagnostics describes the running service
+type Diagnostics struct {
+	Version   string `json:"version"`
+	Revision  string `json:"revision"`
+	GoVersion string `json:"go_version"`
+	Started   int64  `json:"started"`
+	// Seconds since the service started
+	Uptime     int64               `json:"uptime"`
+	Cache      CacheStats          `json:"cache"`
+	RateLimits []EndpointRateLimit `json:"rate_limits"`
+	// Retries Printful calls can still make
+	RetryBudget float64 `json:"retry_budget"`
+}
+
+// CacheStats counts the lookups in the product and variant cache since the service started
+type CacheStats struct {
+	ProductHits   int64 `json:"product_hits"`
+	ProductMisses int64 `json:"product_misses"`
+	// Found but older than the cache max age, fetched again
+	ProductStale  int64 `json:"product_stale"`
+	VariantHits   int64 `json:"variant_hits"`
+	VariantMisses int64 `json:"variant_misses"`
+	VariantStale  int64 `json:"variant_stale"`
+	// Whether the whole catalog went through the cache once
+	WarmedUp    bool `json:"warmed_up"`
+	MockupTasks int  `json:"mockup_tasks"`
+}
+
+// EndpointRateLimit is the state of the Printful rate limit of an endpoint, as learnt from its replies
+type EndpointRateLimit struct {
+	Endpoint string `json:"endpoint"`
+	// 0 until Printful tells it
+	Limit     int `json:"limit"`
+	Remaining int `json:"remaining"`
+	// Seconds before the limit resets, 0 when unknown
+	ResetIn int `json:"reset_in"`
+	// Seconds before calls can be sent again after a 429
+	RetryAfter int `json:"retry_after"`
+	InFlight   int `json:"in_flight"`
+	Waiting    int `json:"waiting"`
+}
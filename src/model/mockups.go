@@ -0,0 +1,37 @@
+package model
+
+type MockupFile struct {
+	Placement string        `json:"placement" mapstructure:"placement" binding:"required"`
+	ImageURL  string        `json:"image_url" mapstructure:"image_url" binding:"required,url"`
+	Position  *FilePosition `json:"position,omitempty" mapstructure:"position"`
+}
+
+type MockupExtra struct {
+	Title       string `json:"title" bson:"title"`
+	URL         string `json:"url" bson:"url"`
+	Option      string `json:"option" bson:"option"`
+	OptionGroup string `json:"option_group" bson:"option_group"`
+}
+
+type Mockup struct {
+	Placement  string        `json:"placement" bson:"placement"`
+	VariantIDs []int         `json:"variant_ids" bson:"variant_ids"`
+	MockupURL  string        `json:"mockup_url" bson:"mockup_url"`
+	Extra      []MockupExtra `json:"extra" bson:"extra"`
+}
+
+type MockupPrintfile struct {
+	VariantIDs []int  `json:"variant_ids" bson:"variant_ids"`
+	Placement  string `json:"placement" bson:"placement"`
+	URL        string `json:"url" bson:"url"`
+}
+
+type MockupTask struct {
+	TaskKey    string            `json:"task_key" bson:"task_key"`
+	Status     string            `json:"status" bson:"status"`
+	Error      string            `json:"error" bson:"error"`
+	Mockups    []Mockup          `json:"mockups" bson:"mockups"`
+	Printfiles []MockupPrintfile `json:"printfiles" bson:"printfiles"`
+	// Local copies of the mockups, filled once the task is completed
+	Files []string `json:"files" bson:"files"`
+}
@@ -1,13 +1,62 @@
 package model
 
 type CreateSyncProductVariant struct {
-	VariantID         int     `mapstructure:"variant_id"`
+	VariantID         int     `mapstructure:"variant_id" binding:"required,min=1"`
 	ExternalVariantID string  `mapstructure:"external_variant_id"`
-	RetailPrice       float64 `mapstructure:"retail_price"`
+	RetailPrice       float64 `mapstructure:"retail_price" binding:"min=0"`
 }
+
+// FilePosition places a design inside the print area, all sizes are in pixels of the area
+type FilePosition struct {
+	AreaWidth        int  `json:"area_width" mapstructure:"area_width"`
+	AreaHeight       int  `json:"area_height" mapstructure:"area_height"`
+	Width            int  `json:"width" mapstructure:"width"`
+	Height           int  `json:"height" mapstructure:"height"`
+	Top              int  `json:"top" mapstructure:"top"`
+	Left             int  `json:"left" mapstructure:"left"`
+	LimitToPrintArea bool `json:"limit_to_print_area" mapstructure:"limit_to_print_area"`
+}
+
+type FileOption struct {
+	ID    string      `json:"id" mapstructure:"id"`
+	Value interface{} `json:"value" mapstructure:"value"`
+}
+
+// DesignSource is where the artwork comes from, only one of the fields is expected
+type DesignSource struct {
+	// Base64 PNG, JPEG, WebP or GIF, with or without a data URL prefix
+	Image string `mapstructure:"image"`
+	// Remote image fetched by the server
+	ImageURL string `mapstructure:"image_url"`
+	// Image previously stored in the images bucket
+	ImageID string `mapstructure:"image_id"`
+}
+
+// Design is an artwork stored in the images bucket
+type Design struct {
+	ID           string `json:"image_id" bson:"image_id"`
+	URL          string `json:"url" bson:"url"`
+	ThumbnailURL string `json:"thumbnail_url" bson:"thumbnail_url"`
+	Format       string `json:"format" bson:"format"`
+	Width        int    `json:"width" bson:"width"`
+	Height       int    `json:"height" bson:"height"`
+}
+
+type SyncProductFile struct {
+	// Placement of the file: default, front, back, sleeve_left, embroidery_chest_left...
+	Type         string `mapstructure:"type"`
+	DesignSource `mapstructure:",squash"`
+	Position     *FilePosition `mapstructure:"position"`
+	Options      []FileOption  `mapstructure:"options"`
+}
+
 type CreateSyncProductDatas struct {
-	ProductID int                        `mapstructure:"product_id"`
-	Variants  []CreateSyncProductVariant `mapstructure:"variants"`
+	ProductID int                        `mapstructure:"product_id" binding:"required,min=1"`
+	Variants  []CreateSyncProductVariant `mapstructure:"variants" binding:"required,min=1,dive"`
 	Name      string                     `mapstructure:"name"`
-	Image     string                     `mapstructure:"image"`
+	// Single design printed on the default placement, ignored when Files is set
+	Image string            `mapstructure:"image"`
+	Files []SyncProductFile `mapstructure:"files"`
+	// Artwork warning codes preventing the creation of the product
+	RejectArtwork []string `mapstructure:"reject_artwork" binding:"dive,artwork_warning"`
 }
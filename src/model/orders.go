@@ -0,0 +1,35 @@
+package model
+
+import (
+	"time"
+
+	"github.com/baldurstod/printful-api-model/schemas"
+)
+
+type Paging struct {
+	Total  int `json:"total" bson:"total"`
+	Offset int `json:"offset" bson:"offset"`
+	Limit  int `json:"limit" bson:"limit"`
+}
+
+type OrderCosts struct {
+	Costs       schemas.Costs       `json:"costs" bson:"costs"`
+	RetailCosts schemas.RetailCosts `json:"retail_costs" bson:"retail_costs"`
+}
+
+// The order is being sent to Printful
+const ORDER_SUBMISSION_PENDING = "pending"
+
+// Printful created the order
+const ORDER_SUBMISSION_CREATED = "created"
+
+// OrderSubmission records an order sent to Printful, so that sending it again returns the existing order
+type OrderSubmission struct {
+	ExternalID string `json:"external_id" bson:"external_id"`
+	// Hash of the order, to tell a resubmission from another order reusing the external id
+	Hash    string    `json:"hash" bson:"hash"`
+	Status  string    `json:"status" bson:"status"`
+	OrderID int64     `json:"order_id" bson:"order_id"`
+	Created time.Time `json:"created" bson:"created"`
+	Updated time.Time `json:"updated" bson:"updated"`
+}
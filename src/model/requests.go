@@ -5,9 +5,30 @@ import (
 	"github.com/baldurstod/printful-api-model/schemas"
 )
 
+type GetProductRequest struct {
+	ProductID int `mapstructure:"product_id" binding:"required,min=1"`
+}
+
+type GetVariantRequest struct {
+	VariantID int `mapstructure:"variant_id" binding:"required,min=1"`
+}
+
+type GetSimilarVariantsRequest struct {
+	VariantID int    `mapstructure:"variant_id" binding:"required,min=1"`
+	Placement string `mapstructure:"placement" default:"default"`
+}
+
+type GetTemplatesRequest struct {
+	ProductID int `mapstructure:"product_id" binding:"required,min=1"`
+}
+
+type GetPrintfilesRequest struct {
+	ProductID int `mapstructure:"product_id" binding:"required,min=1"`
+}
+
 type CalculateShippingRates struct {
 	Recipient printfulAPIModel.AddressInfo `mapstructure:"recipient"`
-	Items     []printfulAPIModel.ItemInfo  `mapstructure:"items"`
+	Items     []printfulAPIModel.ItemInfo  `mapstructure:"items" binding:"required,min=1"`
 	Currency  string                       `mapstructure:"currency"`
 	Locale    string                       `mapstructure:"locale"`
 }
@@ -16,6 +37,99 @@ type CalculateTaxRate struct {
 	Recipient schemas.TaxAddressInfo `mapstructure:"recipient"`
 }
 
+// CreateOrderRequest needs the external id of the order, sending the order again with it never creates a second one
 type CreateOrderRequest struct {
 	Order schemas.Order `mapstructure:"order"`
 }
+
+type CreateMockupTask struct {
+	ProductID  int          `json:"-" mapstructure:"product_id" binding:"required,min=1"`
+	VariantIDs []int        `json:"variant_ids" mapstructure:"variant_ids" binding:"required,min=1,dive,min=1"`
+	Format     string       `json:"format" mapstructure:"format" binding:"omitempty,oneof=jpg png"`
+	Files      []MockupFile `json:"files" mapstructure:"files" binding:"required,min=1,dive"`
+}
+
+type GetMockupTask struct {
+	TaskKey string `mapstructure:"task_key" binding:"required"`
+}
+
+// OrderReference identifies an order either by its Printful id or by its external id
+type OrderReference struct {
+	OrderID    int64  `mapstructure:"order_id" binding:"required_without=ExternalID,min=0"`
+	ExternalID string `mapstructure:"external_id"`
+}
+
+type ListOrdersRequest struct {
+	Status string `mapstructure:"status" binding:"omitempty,oneof=draft pending failed canceled inprocess onhold partial fulfilled archived"`
+	Offset int    `mapstructure:"offset" binding:"min=0"`
+	Limit  int    `mapstructure:"limit" binding:"min=0,max=100"`
+}
+
+type UpdateOrderRequest struct {
+	OrderReference `mapstructure:",squash"`
+	Order          schemas.Order `mapstructure:"order"`
+	Confirm        bool          `mapstructure:"confirm"`
+	// Keys of order the caller sent, Printful replaces every field it is sent
+	Fields []string `mapstructure:"-"`
+}
+
+type EstimateOrderCostsRequest struct {
+	Order schemas.Order `mapstructure:"order"`
+}
+
+type SetWebhooksRequest struct {
+	URL   string   `mapstructure:"url" binding:"required,url"`
+	Types []string `mapstructure:"types" binding:"dive,webhook_event_type"`
+}
+
+// SyncProductReference identifies a sync product either by its Printful id or by its external id
+type SyncProductReference struct {
+	SyncProductID int64  `mapstructure:"sync_product_id" binding:"required_without=ExternalID,min=0"`
+	ExternalID    string `mapstructure:"external_id"`
+}
+
+// SyncVariantReference identifies a sync variant either by its Printful id or by its external id
+type SyncVariantReference struct {
+	SyncVariantID int64  `mapstructure:"sync_variant_id" binding:"required_without=ExternalID,min=0"`
+	ExternalID    string `mapstructure:"external_id"`
+}
+
+type ListSyncProductsRequest struct {
+	Search string `mapstructure:"search"`
+	Offset int    `mapstructure:"offset" binding:"min=0"`
+	Limit  int    `mapstructure:"limit" binding:"min=0,max=100"`
+}
+
+type ModifySyncProductRequest struct {
+	SyncProductReference `mapstructure:",squash"`
+	Name                 string `mapstructure:"name"`
+	// New design, replacing the file of Placement in every sync variant
+	DesignSource `mapstructure:",squash"`
+	// Placement of the file replaced by the design, default when empty
+	Placement string `mapstructure:"placement"`
+	IsIgnored *bool  `mapstructure:"is_ignored"`
+}
+
+// SyncVariantFields holds the fields of a sync variant to create or modify, unset fields are left untouched
+type SyncVariantFields struct {
+	VariantID         int              `mapstructure:"variant_id" binding:"min=0"`
+	ExternalVariantID string           `mapstructure:"external_variant_id"`
+	RetailPrice       *float64         `mapstructure:"retail_price" binding:"omitempty,min=0"`
+	IsIgnored         *bool            `mapstructure:"is_ignored"`
+	Files             []schemas.File   `mapstructure:"files"`
+	Options           []schemas.Option `mapstructure:"options"`
+}
+
+type CreateSyncVariantRequest struct {
+	SyncProductReference `mapstructure:",squash"`
+	SyncVariantFields    `mapstructure:",squash"`
+}
+
+type ModifySyncVariantRequest struct {
+	SyncVariantReference `mapstructure:",squash"`
+	SyncVariantFields    `mapstructure:",squash"`
+}
+
+type UploadImageRequest struct {
+	DesignSource `mapstructure:",squash"`
+}
@@ -0,0 +1,17 @@
+package model
+
+// ClientUsage is the inbound rate limiting state of an API key or an IP
+type ClientUsage struct {
+	Client string `json:"client"`
+	// UTC day the requests are counted for, as YYYY-MM-DD
+	Day        string `json:"day"`
+	Requests   int    `json:"requests"`
+	DailyQuota int    `json:"daily_quota"`
+	// Tokens left in the bucket of each action class used today
+	Buckets  map[string]float64 `json:"buckets"`
+	LastSeen int64              `json:"last_seen"`
+}
+
+type GetUsageRequest struct {
+	Client string `mapstructure:"client"`
+}
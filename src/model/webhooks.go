@@ -0,0 +1,34 @@
+package model
+
+const WEBHOOK_PACKAGE_SHIPPED = "package_shipped"
+const WEBHOOK_PACKAGE_RETURNED = "package_returned"
+const WEBHOOK_ORDER_FAILED = "order_failed"
+const WEBHOOK_ORDER_CANCELED = "order_canceled"
+const WEBHOOK_PRODUCT_SYNCED = "product_synced"
+const WEBHOOK_STOCK_UPDATED = "stock_updated"
+const WEBHOOK_ORDER_PUT_HOLD = "order_put_hold"
+
+var WebhookEventTypes = []string{
+	WEBHOOK_PACKAGE_SHIPPED,
+	WEBHOOK_PACKAGE_RETURNED,
+	WEBHOOK_ORDER_FAILED,
+	WEBHOOK_ORDER_CANCELED,
+	WEBHOOK_PRODUCT_SYNCED,
+	WEBHOOK_STOCK_UPDATED,
+	WEBHOOK_ORDER_PUT_HOLD,
+}
+
+type WebhookEvent struct {
+	Type     string                 `json:"type" bson:"type"`
+	Created  int64                  `json:"created" bson:"created"`
+	Retries  int                    `json:"retries" bson:"retries"`
+	Store    int64                  `json:"store" bson:"store"`
+	Data     map[string]interface{} `json:"data" bson:"data"`
+	Received int64                  `json:"received" bson:"received"`
+}
+
+type WebhookInfo struct {
+	URL    string      `json:"url" bson:"url"`
+	Types  []string    `json:"types" bson:"types"`
+	Params interface{} `json:"params" bson:"params"`
+}
@@ -0,0 +1,101 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"printfulapi/src/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func InsertApiKey(ctx context.Context, key *model.ApiKey) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := apiKeysCollection.InsertOne(ctx, key)
+
+	return err
+}
+
+// FindApiKey returns the key matching a hash, revoked keys included
+func FindApiKey(ctx context.Context, hash string) (*model.ApiKey, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	filter := bson.D{{Key: "hash", Value: hash}}
+
+	key := model.ApiKey{}
+	err := apiKeysCollection.FindOne(ctx, filter).Decode(&key)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ApiKeyNotFoundError{}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+func ListApiKeys(ctx context.Context) ([]model.ApiKey, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	cursor, err := apiKeysCollection.Find(ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []model.ApiKey{}
+	if err = cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func RevokeApiKey(ctx context.Context, id string) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	filter := bson.D{{Key: "id", Value: id}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "revoked", Value: true}}}}
+
+	result, err := apiKeysCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ApiKeyNotFoundError{}
+	}
+
+	return nil
+}
+
+// ApiKeyStore keeps the API keys created by the admin actions in the printful database
+type ApiKeyStore struct{}
+
+func (ApiKeyStore) InsertApiKey(ctx context.Context, key *model.ApiKey) error {
+	return InsertApiKey(ctx, key)
+}
+
+func (ApiKeyStore) FindApiKey(ctx context.Context, hash string) (*model.ApiKey, error) {
+	key, err := FindApiKey(ctx, hash)
+	if errors.As(err, &ApiKeyNotFoundError{}) {
+		return nil, nil
+	}
+	return key, err
+}
+
+func (ApiKeyStore) ListApiKeys(ctx context.Context) ([]model.ApiKey, error) {
+	return ListApiKeys(ctx)
+}
+
+func (ApiKeyStore) RevokeApiKey(ctx context.Context, id string) (bool, error) {
+	err := RevokeApiKey(ctx, id)
+	if errors.As(err, &ApiKeyNotFoundError{}) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -5,3 +5,15 @@ type MaxAgeError struct{}
 func (e MaxAgeError) Error() string {
 	return "Max age error"
 }
+
+type FileNotFoundError struct{}
+
+func (e FileNotFoundError) Error() string {
+	return "File not found"
+}
+
+type ApiKeyNotFoundError struct{}
+
+func (e ApiKeyNotFoundError) Error() string {
+	return "API key not found"
+}
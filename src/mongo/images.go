@@ -3,64 +3,227 @@ package mongo
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	_ "github.com/baldurstod/printful-api-model"
 	_ "go.mongodb.org/mongo-driver/bson"
-	_ "go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/gridfs"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"image"
 	"image/png"
-	"log"
+	"io"
+	"log/slog"
 	"printfulapi/src/config"
-	_ "time"
+	"printfulapi/src/metrics"
+	"printfulapi/src/printful"
+	"time"
 )
 
-var cancelImagesConnect context.CancelFunc
+var imagesClient *mongo.Client
 var imagesBucket *gridfs.Bucket
 
+var imagesTimeout = DEFAULT_QUERY_TIMEOUT
+
 func InitImagesDB(config config.Database) {
-	log.Println(config)
-	var ctx context.Context
-	ctx, cancelImagesConnect = context.WithCancel(context.Background())
+	slog.Info("connecting to the images database", "config", config)
+	if config.Timeout > 0 {
+		imagesTimeout = time.Duration(config.Timeout) * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), imagesTimeout)
+	defer cancel()
+
 	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.ConnectURI))
 	if err != nil {
-		log.Println(err)
+		slog.Error("unable to connect to the images database", "error", err)
 		panic(err)
 	}
-
-	defer closeImagesDB()
+	imagesClient = client
 
 	imagesBucket, err = gridfs.NewBucket(client.Database(config.DBName), options.GridFSBucket().SetName(config.BucketName))
 	if err != nil {
-		log.Println(err)
+		slog.Error("unable to open the images bucket", "error", err)
 		panic(err)
 	}
 }
 
-func closeImagesDB() {
-	if cancelImagesConnect != nil {
-		cancelImagesConnect()
+// writeDeadline bounds an upload by the configured timeout, or by ctx when it ends earlier
+func writeDeadline(ctx context.Context) time.Time {
+	deadline := time.Now().Add(imagesTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		return d
+	}
+	return deadline
+}
+
+func UploadImage(ctx context.Context, filename string, img image.Image) error {
+	buf := bytes.Buffer{}
+	err := png.Encode(&buf, img)
+	if err != nil {
+		return err
+	}
+
+	err = UploadFile(ctx, filename, buf.Bytes())
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to upload image", "filename", filename, "error", err)
 	}
+
+	return err
 }
 
-func UploadImage(filename string, img image.Image) error {
+// UploadFile stores content in the images bucket. The file only exists once Close has written
+// its files document, an upload is a success only if Close succeeds.
+func UploadFile(ctx context.Context, filename string, content []byte) error {
 	uploadStream, err := imagesBucket.OpenUploadStream(filename)
 	if err != nil {
 		return err
 	}
 
-	defer uploadStream.Close()
+	uploadStream.SetWriteDeadline(writeDeadline(ctx))
 
-	buf := bytes.Buffer{}
-	err = png.Encode(&buf, img)
+	fileSize, err := uploadStream.Write(content)
 	if err != nil {
+		// Removes the chunks already written
+		uploadStream.Abort()
 		return err
 	}
 
-	//log.Println(buf)
-	fileSize, err := uploadStream.Write(buf.Bytes())
-	log.Println(fileSize, err)
+	if err = uploadStream.Close(); err != nil {
+		return err
+	}
+	observeUpload(fileSize)
 
 	return nil
 }
+
+func observeUpload(fileSize int) {
+	metrics.GridFSUploads.Inc()
+	metrics.GridFSUploadBytes.Add(float64(fileSize))
+}
+
+type ImageFile struct {
+	ID         string
+	Name       string
+	Length     int64
+	UploadDate time.Time
+	Content    io.ReadSeekCloser
+}
+
+// DownloadImage opens the latest revision of a file in the images bucket, reading it stops when ctx ends
+func DownloadImage(ctx context.Context, filename string) (*ImageFile, error) {
+	stream, err := imagesBucket.OpenDownloadStreamByName(filename)
+	if err != nil {
+		if errors.Is(err, gridfs.ErrFileNotFound) {
+			return nil, FileNotFoundError{}
+		}
+		return nil, err
+	}
+
+	file := stream.GetFile()
+	id := fmt.Sprint(file.ID)
+	if oid, ok := file.ID.(primitive.ObjectID); ok {
+		id = oid.Hex()
+	}
+
+	return &ImageFile{
+		ID:         id,
+		Name:       file.Name,
+		Length:     file.Length,
+		UploadDate: file.UploadDate,
+		Content:    &gridFSReadSeeker{ctx: ctx, fileID: file.ID, length: file.Length, stream: stream},
+	}, nil
+}
+
+// gridFSReadSeeker makes a download stream seekable by reopening it at the requested offset
+type gridFSReadSeeker struct {
+	ctx    context.Context
+	fileID interface{}
+	length int64
+	offset int64
+	stream *gridfs.DownloadStream
+}
+
+func (r *gridFSReadSeeker) Read(p []byte) (int, error) {
+	if r.offset >= r.length {
+		return 0, io.EOF
+	}
+
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	if r.stream == nil {
+		stream, err := imagesBucket.OpenDownloadStream(r.fileID)
+		if err != nil {
+			return 0, err
+		}
+		if _, err = stream.Skip(r.offset); err != nil {
+			stream.Close()
+			return 0, err
+		}
+		r.stream = stream
+	}
+
+	n, err := r.stream.Read(p)
+	r.offset += int64(n)
+
+	return n, err
+}
+
+func (r *gridFSReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = r.offset + offset
+	case io.SeekEnd:
+		abs = r.length + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+
+	if abs < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	if abs != r.offset && r.stream != nil {
+		r.stream.Close()
+		r.stream = nil
+	}
+	r.offset = abs
+
+	return abs, nil
+}
+
+func (r *gridFSReadSeeker) Close() error {
+	if r.stream == nil {
+		return nil
+	}
+
+	err := r.stream.Close()
+	r.stream = nil
+
+	return err
+}
+
+// ImageStore exposes the images bucket to the printful client
+type ImageStore struct{}
+
+func (ImageStore) UploadFile(ctx context.Context, filename string, content []byte) error {
+	return UploadFile(ctx, filename, content)
+}
+
+func (ImageStore) OpenFile(ctx context.Context, filename string) (io.ReadCloser, error) {
+	image, err := DownloadImage(ctx, filename)
+	if errors.As(err, &FileNotFoundError{}) {
+		return nil, printful.NotFoundError{Message: err.Error()}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return image.Content, nil
+}
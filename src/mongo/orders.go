@@ -0,0 +1,88 @@
+package mongo
+
+import (
+	"context"
+	"printfulapi/src/model"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Time an order submission is remembered after its last update
+const ORDER_SUBMISSIONS_RETENTION = 30 * 24 * time.Hour
+
+// createOrderSubmissionsIndexes makes the external id unique and expires the old submissions
+func createOrderSubmissionsIndexes(ctx context.Context) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := orderSubmissionsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "external_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "updated", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(ORDER_SUBMISSIONS_RETENTION.Seconds())),
+		},
+	})
+
+	return err
+}
+
+// InsertOrderSubmission returns the submission already recorded for the external id instead of inserting, if any
+func InsertOrderSubmission(ctx context.Context, submission *model.OrderSubmission) (*model.OrderSubmission, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := orderSubmissionsCollection.InsertOne(ctx, submission)
+	if !mongo.IsDuplicateKeyError(err) {
+		return nil, err
+	}
+
+	filter := bson.D{{Key: "external_id", Value: submission.ExternalID}}
+
+	previous := model.OrderSubmission{}
+	if err := orderSubmissionsCollection.FindOne(ctx, filter).Decode(&previous); err != nil {
+		return nil, err
+	}
+
+	return &previous, nil
+}
+
+func UpdateOrderSubmission(ctx context.Context, submission *model.OrderSubmission) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	filter := bson.D{{Key: "external_id", Value: submission.ExternalID}}
+	_, err := orderSubmissionsCollection.ReplaceOne(ctx, filter, submission, options.Replace().SetUpsert(true))
+
+	return err
+}
+
+func DeleteOrderSubmission(ctx context.Context, externalID string) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	filter := bson.D{{Key: "external_id", Value: externalID}}
+	_, err := orderSubmissionsCollection.DeleteOne(ctx, filter)
+
+	return err
+}
+
+// OrderSubmissionStore records the orders sent to Printful in the printful database
+type OrderSubmissionStore struct{}
+
+func (OrderSubmissionStore) InsertOrderSubmission(ctx context.Context, submission *model.OrderSubmission) (*model.OrderSubmission, error) {
+	return InsertOrderSubmission(ctx, submission)
+}
+
+func (OrderSubmissionStore) UpdateOrderSubmission(ctx context.Context, submission *model.OrderSubmission) error {
+	return UpdateOrderSubmission(ctx, submission)
+}
+
+func (OrderSubmissionStore) DeleteOrderSubmission(ctx context.Context, externalID string) error {
+	return DeleteOrderSubmission(ctx, externalID)
+}
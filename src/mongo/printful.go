@@ -2,42 +2,112 @@ package mongo
 
 import (
 	"context"
+	"errors"
 	"github.com/baldurstod/printful-api-model"
 	"go.mongodb.org/mongo-driver/bson"
 	_ "go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-	"log"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"log/slog"
 	"printfulapi/src/config"
+	"sync/atomic"
 	"time"
 )
 
-var cancelConnect context.CancelFunc
+var printfulClient *mongo.Client
 var productsCollection *mongo.Collection
 var variantsCollection *mongo.Collection
+var webhookEventsCollection *mongo.Collection
+var apiKeysCollection *mongo.Collection
+var orderSubmissionsCollection *mongo.Collection
 
-var cacheMaxAge int64 = 86400
+// Seconds a cached product or variant is served when the configuration doesn't set it
+const DEFAULT_CACHE_MAX_AGE = 86400
+
+var cacheMaxAge atomic.Int64
+
+// Deadline of a query when the configuration doesn't set one
+const DEFAULT_QUERY_TIMEOUT = 5 * time.Second
+
+var queryTimeout = DEFAULT_QUERY_TIMEOUT
 
 func InitPrintfulDB(config config.Database) {
-	log.Println(config)
-	var ctx context.Context
-	ctx, cancelConnect = context.WithCancel(context.Background())
+	slog.Info("connecting to the printful database", "config", config)
+	if config.Timeout > 0 {
+		queryTimeout = time.Duration(config.Timeout) * time.Second
+	}
+	SetCacheMaxAge(config.CacheTTL)
+
+	ctx, cancel := withQueryTimeout(context.Background())
+	defer cancel()
+
 	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.ConnectURI))
 	if err != nil {
-		log.Println(err)
+		slog.Error("unable to connect to the printful database", "error", err)
 		panic(err)
 	}
-
-	defer closePrintfulDB()
+	printfulClient = client
 
 	productsCollection = client.Database(config.DBName).Collection("products")
 	variantsCollection = client.Database(config.DBName).Collection("variants")
+	webhookEventsCollection = client.Database(config.DBName).Collection("webhook_events")
+	apiKeysCollection = client.Database(config.DBName).Collection("api_keys")
+	orderSubmissionsCollection = client.Database(config.DBName).Collection("order_submissions")
+
+	if err := createOrderSubmissionsIndexes(context.Background()); err != nil {
+		slog.Error("unable to create the order submissions indexes", "error", err)
+	}
+}
+
+// SetCacheMaxAge sets the seconds a cached product or variant is served, DEFAULT_CACHE_MAX_AGE when not positive.
+// It is called again when the configuration is reloaded.
+func SetCacheMaxAge(seconds int) {
+	if seconds <= 0 {
+		seconds = DEFAULT_CACHE_MAX_AGE
+	}
+	cacheMaxAge.Store(int64(seconds))
+}
+
+// PingPrintfulDB checks the printful database answers
+func PingPrintfulDB(ctx context.Context) error {
+	return ping(ctx, printfulClient)
+}
+
+// PingImagesDB checks the images database answers
+func PingImagesDB(ctx context.Context) error {
+	return ping(ctx, imagesClient)
+}
+
+func ping(ctx context.Context, client *mongo.Client) error {
+	if client == nil {
+		return errors.New("not connected")
+	}
+
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	return client.Ping(ctx, readpref.Primary())
 }
 
-func closePrintfulDB() {
-	if cancelConnect != nil {
-		cancelConnect()
+// Disconnect closes the connections of the printful and images databases, waiting for the queries in flight until ctx ends
+func Disconnect(ctx context.Context) error {
+	var err error
+	for _, client := range []*mongo.Client{printfulClient, imagesClient} {
+		if client == nil {
+			continue
+		}
+		if e := client.Disconnect(ctx); e != nil {
+			err = e
+		}
 	}
+
+	return err
+}
+
+// withQueryTimeout bounds a query by the configured timeout, or by ctx when it ends earlier
+func withQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, queryTimeout)
 }
 
 type MongoProductInfo struct {
@@ -46,11 +116,11 @@ type MongoProductInfo struct {
 	ProductInfo model.ProductInfo `json:"product_info" bson:"product_info"`
 }
 
-func FindProduct(productID int) (*model.ProductInfo, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func FindProduct(ctx context.Context, productID int) (*model.ProductInfo, error) {
+	ctx, cancel := withQueryTimeout(ctx)
 	defer cancel()
 
-	filter := bson.D{{"id", productID}}
+	filter := bson.D{{Key: "id", Value: productID}}
 
 	r := productsCollection.FindOne(ctx, filter)
 
@@ -59,20 +129,20 @@ func FindProduct(productID int) (*model.ProductInfo, error) {
 		return nil, err
 	}
 
-	if time.Now().Unix()-doc.LastUpdated > cacheMaxAge {
+	if time.Now().Unix()-doc.LastUpdated > cacheMaxAge.Load() {
 		return &doc.ProductInfo, MaxAgeError{}
 	}
 
 	return &doc.ProductInfo, nil
 }
 
-func InsertProduct(productInfo *model.ProductInfo) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func InsertProduct(ctx context.Context, productInfo *model.ProductInfo) error {
+	ctx, cancel := withQueryTimeout(ctx)
 	defer cancel()
 
 	opts := options.Replace().SetUpsert(true)
 
-	filter := bson.D{{"id", productInfo.Product.ID}}
+	filter := bson.D{{Key: "id", Value: productInfo.Product.ID}}
 	doc := MongoProductInfo{ID: productInfo.Product.ID, LastUpdated: time.Now().Unix(), ProductInfo: *productInfo}
 	_, err := productsCollection.ReplaceOne(ctx, filter, doc, opts)
 
@@ -85,11 +155,11 @@ type MongoVariantInfo struct {
 	VariantInfo model.VariantInfo `json:"variant_info" bson:"variant_info"`
 }
 
-func FindVariant(variantID int) (*model.VariantInfo, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func FindVariant(ctx context.Context, variantID int) (*model.VariantInfo, error) {
+	ctx, cancel := withQueryTimeout(ctx)
 	defer cancel()
 
-	filter := bson.D{{"id", variantID}}
+	filter := bson.D{{Key: "id", Value: variantID}}
 
 	r := variantsCollection.FindOne(ctx, filter)
 
@@ -98,22 +168,41 @@ func FindVariant(variantID int) (*model.VariantInfo, error) {
 		return nil, err
 	}
 
-	if time.Now().Unix()-doc.LastUpdated > cacheMaxAge {
+	if time.Now().Unix()-doc.LastUpdated > cacheMaxAge.Load() {
 		return &doc.VariantInfo, MaxAgeError{}
 	}
 
 	return &doc.VariantInfo, nil
 }
 
-func InsertVariant(variantInfo *model.VariantInfo) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func InsertVariant(ctx context.Context, variantInfo *model.VariantInfo) error {
+	ctx, cancel := withQueryTimeout(ctx)
 	defer cancel()
 
 	opts := options.Replace().SetUpsert(true)
 
-	filter := bson.D{{"id", variantInfo.Variant.ID}}
+	filter := bson.D{{Key: "id", Value: variantInfo.Variant.ID}}
 	doc := MongoVariantInfo{ID: variantInfo.Variant.ID, LastUpdated: time.Now().Unix(), VariantInfo: *variantInfo}
 	_, err := variantsCollection.ReplaceOne(ctx, filter, doc, opts)
 
 	return err
 }
+
+// ProductCache stores catalog products and variants in the printful database
+type ProductCache struct{}
+
+func (ProductCache) FindProduct(ctx context.Context, productID int) (*model.ProductInfo, error) {
+	return FindProduct(ctx, productID)
+}
+
+func (ProductCache) InsertProduct(ctx context.Context, productInfo *model.ProductInfo) error {
+	return InsertProduct(ctx, productInfo)
+}
+
+func (ProductCache) FindVariant(ctx context.Context, variantID int) (*model.VariantInfo, error) {
+	return FindVariant(ctx, variantID)
+}
+
+func (ProductCache) InsertVariant(ctx context.Context, variantInfo *model.VariantInfo) error {
+	return InsertVariant(ctx, variantInfo)
+}
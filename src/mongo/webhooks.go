@@ -0,0 +1,22 @@
+package mongo
+
+import (
+	"context"
+	"printfulapi/src/model"
+)
+
+func InsertWebhookEvent(ctx context.Context, event *model.WebhookEvent) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := webhookEventsCollection.InsertOne(ctx, event)
+
+	return err
+}
+
+// WebhookEventStore logs webhook events in the printful database
+type WebhookEventStore struct{}
+
+func (WebhookEventStore) InsertWebhookEvent(ctx context.Context, event *model.WebhookEvent) error {
+	return InsertWebhookEvent(ctx, event)
+}
@@ -0,0 +1,194 @@
+package printful
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"math"
+	"printfulapi/src/model"
+	"strings"
+
+	printfulAPIModel "github.com/baldurstod/printful-api-model"
+)
+
+// Relative difference of aspect ratio tolerated before warning about letterboxing or cropping
+const ARTWORK_RATIO_TOLERANCE = 0.01
+
+// ValidateArtwork checks the designs of a product are good enough to be printed on every variant
+func (c *Client) ValidateArtwork(ctx context.Context, request model.ValidateArtworkRequest) (*model.ArtworkValidation, error) {
+	printfileInfo, err := c.GetPrintfiles(ctx, request.ProductID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validatePlacements(printfileInfo, request.VariantIDs, request.Files)
+	if err != nil {
+		return nil, err
+	}
+
+	designs, err := c.loadDesigns(ctx, request.Files)
+	if err != nil {
+		return nil, err
+	}
+
+	return checkArtwork(printfileInfo, request.VariantIDs, request.Files, designs, request.Reject)
+}
+
+func (c *Client) loadDesigns(ctx context.Context, files []model.SyncProductFile) ([]*decodedDesign, error) {
+	designs := make([]*decodedDesign, 0, len(files))
+	for _, file := range files {
+		design, err := c.loadDesign(ctx, file.DesignSource)
+		if err != nil {
+			return nil, fmt.Errorf("placement %s: %w", file.Type, err)
+		}
+		designs = append(designs, design)
+	}
+
+	return designs, nil
+}
+
+// checkArtwork reports every file on every variant, the artwork is not ready when one of the reject codes is raised
+func checkArtwork(printfileInfo *printfulAPIModel.PrintfileInfo, variantIDs []int, files []model.SyncProductFile, designs []*decodedDesign, reject []string) (*model.ArtworkValidation, error) {
+	for _, code := range reject {
+		if !isArtworkWarningCode(code) {
+			return nil, ValidationError{Message: fmt.Sprintf("unknown artwork warning %s", code)}
+		}
+	}
+
+	validation := &model.ArtworkValidation{Ready: true, Reports: []model.ArtworkReport{}}
+	for i, file := range files {
+		// Scanning the pixels is the costly part, it is done once whatever the number of variants
+		transparent := hasTransparency(designs[i].image)
+		for _, variantID := range variantIDs {
+			printfile := findPrintfile(printfileInfo, variantID, file.Type)
+			if printfile == nil {
+				return nil, ValidationError{Message: fmt.Sprintf("placement %s is not available for variant %d", file.Type, variantID)}
+			}
+
+			report := artworkReport(file, variantID, printfile, designs[i].image, transparent)
+			for _, warning := range report.Warnings {
+				if containsString(reject, warning.Code) {
+					validation.Ready = false
+				}
+			}
+			validation.Reports = append(validation.Reports, report)
+		}
+	}
+
+	return validation, nil
+}
+
+func artworkReport(file model.SyncProductFile, variantID int, printfile *printfulAPIModel.Printfile, img image.Image, transparent bool) model.ArtworkReport {
+	bounds := img.Bounds()
+	report := model.ArtworkReport{
+		Placement:       file.Type,
+		VariantID:       variantID,
+		PrintfileID:     printfile.PrintfileID,
+		PrintfileWidth:  printfile.Width,
+		PrintfileHeight: printfile.Height,
+		PrintfileDPI:    printfile.DPI,
+		ImageWidth:      bounds.Dx(),
+		ImageHeight:     bounds.Dy(),
+		Warnings:        []model.ArtworkWarning{},
+	}
+
+	if report.ImageWidth == 0 || report.ImageHeight == 0 || printfile.Width == 0 || printfile.Height == 0 {
+		return report
+	}
+
+	// Size of the printed design, in printfile pixels
+	boxWidth, boxHeight := float64(printfile.Width), float64(printfile.Height)
+	if p := file.Position; p != nil && p.AreaWidth > 0 && p.AreaHeight > 0 {
+		boxWidth = float64(p.Width) * boxWidth / float64(p.AreaWidth)
+		boxHeight = float64(p.Height) * boxHeight / float64(p.AreaHeight)
+	}
+
+	scaleX := boxWidth / float64(report.ImageWidth)
+	scaleY := boxHeight / float64(report.ImageHeight)
+	cover := printfile.FillMode == "cover" && file.Position == nil
+
+	scale := math.Min(scaleX, scaleY)
+	if cover {
+		scale = math.Max(scaleX, scaleY)
+	}
+
+	report.EffectiveDPI = int(float64(printfile.DPI) / scale)
+	if report.EffectiveDPI < printfile.DPI {
+		report.Warnings = append(report.Warnings, model.ArtworkWarning{
+			Code:    model.ARTWORK_LOW_DPI,
+			Message: fmt.Sprintf("effective resolution is %d DPI, %d DPI expected", report.EffectiveDPI, printfile.DPI),
+		})
+	}
+
+	if math.Abs(scaleX/scaleY-1) > ARTWORK_RATIO_TOLERANCE {
+		if cover {
+			report.Warnings = append(report.Warnings, model.ArtworkWarning{
+				Code:    model.ARTWORK_CROPPING,
+				Message: fmt.Sprintf("a %dx%d image will be cropped to fit a %dx%d print area", report.ImageWidth, report.ImageHeight, int(boxWidth), int(boxHeight)),
+			})
+		} else {
+			report.Warnings = append(report.Warnings, model.ArtworkWarning{
+				Code:    model.ARTWORK_LETTERBOXING,
+				Message: fmt.Sprintf("a %dx%d image will be letterboxed to fit a %dx%d print area", report.ImageWidth, report.ImageHeight, int(boxWidth), int(boxHeight)),
+			})
+		}
+	}
+
+	if transparent {
+		report.Warnings = append(report.Warnings, model.ArtworkWarning{
+			Code:    model.ARTWORK_TRANSPARENCY,
+			Message: "image has transparent pixels",
+		})
+	}
+
+	return report
+}
+
+// rejectedArtwork returns an error describing the warnings listed in reject
+func rejectedArtwork(validation *model.ArtworkValidation, reject []string) error {
+	problems := []string{}
+	for _, report := range validation.Reports {
+		for _, warning := range report.Warnings {
+			if containsString(reject, warning.Code) {
+				problems = append(problems, fmt.Sprintf("placement %s on variant %d: %s", report.Placement, report.VariantID, warning.Message))
+			}
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	return ValidationError{Message: "artwork rejected: " + strings.Join(problems, ", ")}
+}
+
+func hasTransparency(img image.Image) bool {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok {
+		return !opaque.Opaque()
+	}
+
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xffff {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func isArtworkWarningCode(code string) bool {
+	return containsString(model.ArtworkWarningCodes, code)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
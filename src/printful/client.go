@@ -0,0 +1,512 @@
+package printful
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"printfulapi/src/config"
+	"printfulapi/src/metrics"
+	"printfulapi/src/model"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	printfulAPIModel "github.com/baldurstod/printful-api-model"
+)
+
+const DEFAULT_BASE_URL = "https://api.printful.com"
+
+// Deadline of a call to Printful when the configuration doesn't set one
+const DEFAULT_CALL_TIMEOUT = 30 * time.Second
+
+const PRINTFUL_PRODUCTS_API = "/products"
+const PRINTFUL_STORE_API = "/store"
+const PRINTFUL_MOCKUP_GENERATOR_API = "/mockup-generator"
+const PRINTFUL_MOCKUP_GENERATOR_API_CREATE_TASK = "/mockup-generator/create-task"
+const PRINTFUL_COUNTRIES_API = "/countries"
+const PRINTFUL_ORDERS_API = "/orders"
+const PRINTFUL_SHIPPING_API = "/shipping"
+const PRINTFUL_TAX_API = "/tax"
+const PRINTFUL_WEBHOOKS_API = "/webhooks"
+const PRINTFUL_OAUTH_API = "/oauth"
+
+// Time the catalog product list is kept when the configuration doesn't set one
+const DEFAULT_CATALOG_TTL = 12 * time.Hour
+
+// Wait before warming the cache again after a failure
+const WARM_UP_RETRY = time.Minute
+
+// Cache stores catalog products and variants between calls
+type Cache interface {
+	FindProduct(ctx context.Context, productID int) (*printfulAPIModel.ProductInfo, error)
+	InsertProduct(ctx context.Context, productInfo *printfulAPIModel.ProductInfo) error
+	FindVariant(ctx context.Context, variantID int) (*printfulAPIModel.VariantInfo, error)
+	InsertVariant(ctx context.Context, variantInfo *printfulAPIModel.VariantInfo) error
+}
+
+// ImageStore keeps the designs and mockups served to Printful through ImagesURL
+type ImageStore interface {
+	UploadFile(ctx context.Context, filename string, content []byte) error
+	// OpenFile returns a NotFoundError when no file has that name
+	OpenFile(ctx context.Context, filename string) (io.ReadCloser, error)
+}
+
+// OrderSubmissionStore records the orders sent to Printful
+type OrderSubmissionStore interface {
+	// InsertOrderSubmission returns the submission already recorded for the external id, if any, instead of inserting
+	InsertOrderSubmission(ctx context.Context, submission *model.OrderSubmission) (*model.OrderSubmission, error)
+	UpdateOrderSubmission(ctx context.Context, submission *model.OrderSubmission) error
+	DeleteOrderSubmission(ctx context.Context, externalID string) error
+}
+
+type noCache struct{}
+
+func (noCache) FindProduct(context.Context, int) (*printfulAPIModel.ProductInfo, error) {
+	return nil, errors.New("no cache")
+}
+
+func (noCache) InsertProduct(context.Context, *printfulAPIModel.ProductInfo) error {
+	return nil
+}
+
+func (noCache) FindVariant(context.Context, int) (*printfulAPIModel.VariantInfo, error) {
+	return nil, errors.New("no cache")
+}
+
+func (noCache) InsertVariant(context.Context, *printfulAPIModel.VariantInfo) error {
+	return nil
+}
+
+// noSubmissions records nothing, Printful still refuses an external id it already knows
+type noSubmissions struct{}
+
+func (noSubmissions) InsertOrderSubmission(context.Context, *model.OrderSubmission) (*model.OrderSubmission, error) {
+	return nil, nil
+}
+
+func (noSubmissions) UpdateOrderSubmission(context.Context, *model.OrderSubmission) error {
+	return nil
+}
+
+func (noSubmissions) DeleteOrderSubmission(context.Context, string) error {
+	return nil
+}
+
+type Client struct {
+	baseURL     string
+	accessToken string
+	storeID     string
+	httpClient  *http.Client
+	// Fetches the designs given by URL
+	imageClient       *http.Client
+	privateImageHosts bool
+	cache             Cache
+	images            ImageStore
+	submissions       OrderSubmissionStore
+	config            config.Printful
+	limiter           *rateLimiter
+	retryBudget       *retryBudget
+
+	// Settings Reload changes while the client runs
+	callTimeout   time.Duration
+	retryPolicy   RetryPolicy
+	catalogTTL    time.Duration
+	settingsMutex sync.RWMutex
+
+	cachedProducts        []printfulAPIModel.Product
+	cachedProductsUpdated time.Time
+	cachedProductsMutex   sync.Mutex
+
+	mockupTasks      map[string]*trackedMockupTask
+	mockupTasksMutex sync.RWMutex
+
+	productLookups lookupStats
+	variantLookups lookupStats
+	warmedUp       atomic.Bool
+
+	// Ends when the client is closed, background tasks run with it
+	closing         context.Context
+	stop            context.CancelFunc
+	background      sync.WaitGroup
+	backgroundMutex sync.Mutex
+}
+
+type Option func(*Client)
+
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		c.baseURL = baseURL
+	}
+}
+
+func WithAccessToken(accessToken string) Option {
+	return func(c *Client) {
+		c.accessToken = accessToken
+	}
+}
+
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithPrivateImageHosts lets the designs be fetched from loopback and private addresses,
+// for the tests and for the deployments trusting everyone able to call the API
+func WithPrivateImageHosts() Option {
+	return func(c *Client) {
+		c.privateImageHosts = true
+		c.imageClient = newImageClient(true)
+	}
+}
+
+// WithCallTimeout bounds each call to Printful, rate limit waits and retries included
+func WithCallTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.callTimeout = timeout
+	}
+}
+
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retryPolicy = policy
+	}
+}
+
+func WithStoreID(storeID string) Option {
+	return func(c *Client) {
+		c.storeID = storeID
+	}
+}
+
+func WithCache(cache Cache) Option {
+	return func(c *Client) {
+		c.cache = cache
+	}
+}
+
+func WithImageStore(images ImageStore) Option {
+	return func(c *Client) {
+		c.images = images
+	}
+}
+
+func WithOrderSubmissionStore(submissions OrderSubmissionStore) Option {
+	return func(c *Client) {
+		c.submissions = submissions
+	}
+}
+
+// WithConfig applies the access token, store, base URL, timeouts, retries and mockup settings of a configuration
+func WithConfig(config config.Printful) Option {
+	return func(c *Client) {
+		c.config = config
+		c.accessToken = config.AccessToken
+		c.storeID = config.StoreID
+		if config.BaseURL != "" {
+			c.baseURL = config.BaseURL
+		}
+		c.applySettings(config)
+	}
+}
+
+func (c *Client) applySettings(config config.Printful) {
+	if config.CallTimeout > 0 {
+		c.callTimeout = time.Duration(config.CallTimeout) * time.Second
+	}
+	if config.Retry.MaxAttempts > 0 {
+		c.retryPolicy.MaxAttempts = config.Retry.MaxAttempts
+	}
+	if config.Retry.BaseDelay > 0 {
+		c.retryPolicy.BaseDelay = time.Duration(config.Retry.BaseDelay) * time.Millisecond
+	}
+	if config.Retry.MaxDelay > 0 {
+		c.retryPolicy.MaxDelay = time.Duration(config.Retry.MaxDelay) * time.Millisecond
+	}
+	if config.Retry.Budget > 0 {
+		c.retryPolicy.Budget = config.Retry.Budget
+	}
+	if config.CatalogTTL > 0 {
+		c.catalogTTL = time.Duration(config.CatalogTTL) * time.Second
+	}
+}
+
+// Reload applies the call timeout, retry policy and catalog TTL of a new configuration to a running client,
+// the settings it doesn't set go back to their default
+func (c *Client) Reload(config config.Printful) {
+	c.settingsMutex.Lock()
+	defer c.settingsMutex.Unlock()
+
+	c.callTimeout = DEFAULT_CALL_TIMEOUT
+	c.retryPolicy = DefaultRetryPolicy
+	c.catalogTTL = DEFAULT_CATALOG_TTL
+	c.applySettings(config)
+}
+
+func (c *Client) timeout() time.Duration {
+	c.settingsMutex.RLock()
+	defer c.settingsMutex.RUnlock()
+
+	return c.callTimeout
+}
+
+func (c *Client) retry() RetryPolicy {
+	c.settingsMutex.RLock()
+	defer c.settingsMutex.RUnlock()
+
+	return c.retryPolicy
+}
+
+func (c *Client) catalogExpiry() time.Duration {
+	c.settingsMutex.RLock()
+	defer c.settingsMutex.RUnlock()
+
+	return c.catalogTTL
+}
+
+func NewClient(opts ...Option) *Client {
+	c := &Client{
+		baseURL:        DEFAULT_BASE_URL,
+		httpClient:     http.DefaultClient,
+		imageClient:    newImageClient(false),
+		cache:          noCache{},
+		submissions:    noSubmissions{},
+		limiter:        newRateLimiter(),
+		callTimeout:    DEFAULT_CALL_TIMEOUT,
+		retryPolicy:    DefaultRetryPolicy,
+		catalogTTL:     DEFAULT_CATALOG_TTL,
+		retryBudget:    newRetryBudget(),
+		cachedProducts: make([]printfulAPIModel.Product, 0),
+		mockupTasks:    make(map[string]*trackedMockupTask),
+	}
+	c.closing, c.stop = context.WithCancel(context.Background())
+	c.productLookups.kind = "product"
+	c.variantLookups.kind = "variant"
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// goBackground runs fn until the client is closed, fn is not run once it is
+func (c *Client) goBackground(fn func(ctx context.Context)) {
+	c.backgroundMutex.Lock()
+	defer c.backgroundMutex.Unlock()
+
+	if c.closing.Err() != nil {
+		return
+	}
+
+	c.background.Add(1)
+	go func() {
+		defer c.background.Done()
+		fn(c.closing)
+	}()
+}
+
+// WarmUp runs InitAllProducts in the background until it succeeds or the client is closed
+func (c *Client) WarmUp() {
+	c.goBackground(func(ctx context.Context) {
+		for {
+			err := c.InitAllProducts(ctx)
+			if err == nil {
+				c.warmedUp.Store(true)
+				return
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			slog.WarnContext(ctx, "catalog warm-up failed, trying again later", "error", err)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(WARM_UP_RETRY):
+			}
+		}
+	})
+}
+
+// Close stops the warm-up and the mockup pollers, and waits for them until ctx ends
+func (c *Client) Close(ctx context.Context) error {
+	c.backgroundMutex.Lock()
+	c.stop()
+	c.backgroundMutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.background.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// fetch sends a call once the rate limit of the endpoint allows it, and sends it again after a 429.
+// Calls failing with a 5xx or a network error are retried as the retry policy allows, as long as
+// they are idempotent: GET, PUT and DELETE are, a POST only with the idempotent or idempotencyKey options.
+// The whole call, waits included, ends with ctx or after the call timeout. The body of the returned
+// response is already read, so that it outlives the deadline.
+func (c *Client) fetch(ctx context.Context, method string, endPoint string, path string, body map[string]interface{}, opts ...callOption) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout())
+	defer cancel()
+
+	call := callOptions{idempotent: method != "POST"}
+	for _, opt := range opts {
+		opt(&call)
+	}
+
+	path, query, _ := strings.Cut(path, "?")
+	u, err := url.JoinPath(c.baseURL, endPoint, path)
+	if err != nil {
+		return nil, errors.New("unable to create URL")
+	}
+	if query != "" {
+		u += "?" + query
+	}
+
+	var content []byte
+	if body != nil {
+		content, err = json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c.retryBudget.deposit(c.retry().Budget)
+
+	rateLimited := 0
+	failures := 0
+	for {
+		// A refusal of the limiter is not a Printful failure, it is neither retried nor charged to the retry budget
+		if err := c.limiter.wait(ctx, endPoint); err != nil {
+			return nil, err
+		}
+
+		resp, retryAfter, err := c.send(ctx, method, u, endPoint, content, call.idempotencyKey)
+		if err == nil {
+			switch {
+			case resp.StatusCode == http.StatusOK:
+				return readResponse(resp)
+			case resp.StatusCode == http.StatusTooManyRequests:
+				resp.Body.Close()
+				if rateLimited < MAX_RATE_LIMITED_RETRIES {
+					rateLimited++
+					continue
+				}
+				return nil, RateLimitedError{RetryAfter: retryAfter}
+			case !isTransientStatus(resp.StatusCode):
+				defer resp.Body.Close()
+				return nil, upstreamError(resp)
+			}
+
+			err = upstreamError(resp)
+			resp.Body.Close()
+		}
+
+		failures++
+		resp, err = c.retryFailure(ctx, call, failures, err)
+		if err != nil {
+			return nil, err
+		}
+		if resp != nil {
+			return resp, nil
+		}
+	}
+}
+
+// send sends a call once the limiter admitted it, it returns how long to wait before sending it again
+// when Printful answers 429
+func (c *Client) send(ctx context.Context, method string, u string, endPoint string, content []byte, idempotencyKey string) (*http.Response, time.Duration, error) {
+	var requestBody io.Reader
+	if content != nil {
+		// A new reader for each attempt, so that retries send the whole body
+		requestBody = bytes.NewReader(content)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, requestBody)
+	if err != nil {
+		c.limiter.done(endPoint, nil)
+		return nil, 0, err
+	}
+
+	if c.accessToken != "" {
+		req.Header.Add("Authorization", "Bearer "+c.accessToken)
+	}
+	if c.storeID != "" {
+		req.Header.Add("X-PF-Store-Id", c.storeID)
+	}
+	if idempotencyKey != "" {
+		req.Header.Add("Idempotency-Key", idempotencyKey)
+	}
+
+	start := time.Now()
+	resp, err := c.httpClient.Do(req)
+	metrics.PrintfulDuration.WithLabelValues(endPoint).Observe(metrics.Since(start))
+	if err != nil {
+		metrics.PrintfulRequests.WithLabelValues(endPoint, metrics.NO_REPLY).Inc()
+		c.limiter.done(endPoint, nil)
+		return nil, 0, UpstreamError{Message: "unable to reach printful", Err: err}
+	}
+
+	metrics.PrintfulRequests.WithLabelValues(endPoint, strconv.Itoa(resp.StatusCode)).Inc()
+	if resp.StatusCode == http.StatusTooManyRequests {
+		metrics.PrintfulRateLimited.WithLabelValues(endPoint).Inc()
+	}
+
+	return resp, c.limiter.done(endPoint, resp), nil
+}
+
+func readResponse(resp *http.Response) (*http.Response, error) {
+	content, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, UpstreamError{Message: "unable to read printful response", Err: err}
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(content))
+
+	return resp, nil
+}
+
+// upstreamError turns a Printful error reply into a NotFoundError or an UpstreamError
+func upstreamError(resp *http.Response) error {
+	response := printfulErrorResponse{}
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		slog.Warn("unable to decode printful error", "status", resp.StatusCode, "error", err)
+	}
+
+	message := response.Error.Message
+	if message == "" {
+		if result, ok := response.Result.(string); ok {
+			message = result
+		} else {
+			message = http.StatusText(resp.StatusCode)
+		}
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return NotFoundError{Message: message}
+	}
+
+	return UpstreamError{
+		StatusCode: resp.StatusCode,
+		Code:       response.Code,
+		Reason:     response.Error.Reason,
+		Message:    message,
+	}
+}
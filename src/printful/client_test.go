@@ -0,0 +1,56 @@
+package printful
+
+import (
+	"context"
+	"errors"
+	"printfulapi/src/printful/printfultest"
+	"testing"
+	"time"
+)
+
+func TestClose(t *testing.T) {
+	server := printfultest.NewServer()
+	defer server.Close()
+	server.SetDelay(time.Minute)
+
+	c := NewClient(WithBaseURL(server.URL))
+	c.WarmUp()
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := c.Close(ctx); err != nil {
+		t.Fatalf("closing should stop the warm-up, got %v", err)
+	}
+
+	// Nothing runs once closed
+	before := len(server.Requests())
+	c.WarmUp()
+	time.Sleep(20 * time.Millisecond)
+	if sent := len(server.Requests()) - before; sent != 0 {
+		t.Errorf("a closed client should not warm up, sent %d requests", sent)
+	}
+}
+
+func TestFetchLimiterRefusal(t *testing.T) {
+	server := printfultest.NewServer()
+	defer server.Close()
+
+	c := NewClient(WithBaseURL(server.URL))
+	c.limiter.mutex.Lock()
+	c.limiter.bucket(PRINTFUL_COUNTRIES_API).retryAfter = time.Now().Add(time.Hour)
+	c.limiter.mutex.Unlock()
+
+	// The limiter refuses at once, without a retry
+	budget := c.retryBudget.available()
+	_, err := c.fetch(context.Background(), "GET", PRINTFUL_COUNTRIES_API, "", nil)
+	if !errors.As(err, &RateLimitedError{}) {
+		t.Errorf("the refusal of the limiter should be returned, got %v", err)
+	}
+	if c.retryBudget.available() < budget {
+		t.Errorf("a refusal of the limiter should not spend the retry budget, %v left of %v", c.retryBudget.available(), budget)
+	}
+	if requests := server.Requests(); len(requests) != 0 {
+		t.Errorf("nothing should be sent, got %v", requests)
+	}
+}
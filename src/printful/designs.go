@@ -0,0 +1,364 @@
+package printful
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"printfulapi/src/model"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/baldurstod/randstr"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const MAX_IMAGE_BYTES = 50 << 20
+const MAX_IMAGE_DIMENSION = 20000
+const IMAGE_FETCH_TIMEOUT = 30 * time.Second
+const MAX_IMAGE_REDIRECTS = 5
+const THUMBNAIL_SIZE = 200
+
+var imageIDPattern = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+
+// Blocks which are not public but that net.IP doesn't report as private
+var reservedNetworks = []*net.IPNet{
+	mustParseCIDR("0.0.0.0/8"),
+	mustParseCIDR("100.64.0.0/10"),
+	mustParseCIDR("192.0.0.0/24"),
+	mustParseCIDR("198.18.0.0/15"),
+	mustParseCIDR("240.0.0.0/4"),
+}
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
+
+func isDesignSourceEmpty(source model.DesignSource) bool {
+	return source.Image == "" && source.ImageURL == "" && source.ImageID == ""
+}
+
+// UploadImage stores a design in the images bucket so it can be used by several products
+func (c *Client) UploadImage(ctx context.Context, request model.UploadImageRequest) (*model.Design, error) {
+	if request.ImageID != "" {
+		return nil, ValidationError{Message: "image is already uploaded"}
+	}
+
+	return c.uploadDesign(ctx, request.DesignSource)
+}
+
+// decodedDesign is an artwork loaded in memory, ready to be checked and stored
+type decodedDesign struct {
+	// Set when the design is already in the images bucket
+	id      string
+	content []byte
+	image   image.Image
+	format  string
+}
+
+// uploadDesign stores a design and its thumbnail in the images bucket and returns their URLs.
+// Designs given by id are not uploaded again.
+func (c *Client) uploadDesign(ctx context.Context, source model.DesignSource) (*model.Design, error) {
+	design, err := c.loadDesign(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.storeDesign(ctx, design)
+}
+
+func (c *Client) loadDesign(ctx context.Context, source model.DesignSource) (*decodedDesign, error) {
+	if c.images == nil {
+		return nil, errors.New("no image store configured")
+	}
+
+	design := &decodedDesign{}
+	var err error
+	if source.ImageID != "" {
+		design.id = source.ImageID
+		design.content, err = c.readStoredDesign(ctx, source.ImageID)
+	} else {
+		design.content, err = c.readDesign(ctx, source)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(design.content))
+	if err != nil {
+		slog.InfoContext(ctx, "unsupported image format", "error", err)
+		return nil, ValidationError{Message: "unsupported image format"}
+	}
+
+	if config.Width > MAX_IMAGE_DIMENSION || config.Height > MAX_IMAGE_DIMENSION {
+		return nil, ValidationError{Message: "image too large"}
+	}
+
+	design.image, design.format, err = image.Decode(bytes.NewReader(design.content))
+	if err != nil {
+		return nil, err
+	}
+
+	return design, nil
+}
+
+func (c *Client) storeDesign(ctx context.Context, design *decodedDesign) (*model.Design, error) {
+	if design.id != "" {
+		return c.newDesign(design.id, design.format, design.image.Bounds())
+	}
+
+	content := design.content
+	// Printful prints PNG and JPEG files, other formats are converted
+	if design.format != "png" && design.format != "jpeg" {
+		buf := bytes.Buffer{}
+		if err := png.Encode(&buf, design.image); err != nil {
+			return nil, err
+		}
+		content = buf.Bytes()
+	}
+
+	thumbnail := bytes.Buffer{}
+	if err := png.Encode(&thumbnail, scaleThumbnail(design.image)); err != nil {
+		return nil, err
+	}
+
+	filename := randstr.String(32)
+	slog.DebugContext(ctx, "storing design", "filename", filename)
+
+	err := c.images.UploadFile(ctx, filename, content)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to store design", "filename", filename, "error", err)
+		return nil, err
+	}
+
+	err = c.images.UploadFile(ctx, filename+"_thumb", thumbnail.Bytes())
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to store design thumbnail", "filename", filename, "error", err)
+		return nil, err
+	}
+
+	design.id = filename
+
+	return c.newDesign(filename, design.format, design.image.Bounds())
+}
+
+func (c *Client) newDesign(filename string, format string, bounds image.Rectangle) (*model.Design, error) {
+	imageURL, err := url.JoinPath(c.config.ImagesURL, "/", filename)
+	if err != nil {
+		return nil, errors.New("unable to create image url")
+	}
+
+	thumbnailURL, err := url.JoinPath(c.config.ImagesURL, "/", filename+"_thumb")
+	if err != nil {
+		return nil, errors.New("unable to create thumbnail url")
+	}
+
+	return &model.Design{
+		ID:           filename,
+		URL:          imageURL,
+		ThumbnailURL: thumbnailURL,
+		Format:       format,
+		Width:        bounds.Dx(),
+		Height:       bounds.Dy(),
+	}, nil
+}
+
+func (c *Client) readStoredDesign(ctx context.Context, imageID string) ([]byte, error) {
+	if !imageIDPattern.MatchString(imageID) {
+		return nil, ValidationError{Message: "invalid image id"}
+	}
+
+	file, err := c.images.OpenFile(ctx, imageID)
+	if err != nil {
+		// Other failures of the store, such as an outage, are not the client's
+		if errors.As(err, &NotFoundError{}) {
+			slog.InfoContext(ctx, "unable to open image", "image_id", imageID, "error", err)
+			return nil, NotFoundError{Message: fmt.Sprintf("image %s not found", imageID)}
+		}
+		return nil, fmt.Errorf("unable to open image %s: %w", imageID, err)
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(io.LimitReader(file, MAX_IMAGE_BYTES+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(content) > MAX_IMAGE_BYTES {
+		return nil, ValidationError{Message: "image too large"}
+	}
+
+	return content, nil
+}
+
+// readDesign returns the raw bytes of an inline or remote design
+func (c *Client) readDesign(ctx context.Context, source model.DesignSource) ([]byte, error) {
+	if source.Image != "" {
+		b64data := source.Image[strings.IndexByte(source.Image, ',')+1:] // Remove data:image/png;base64,
+		if base64.StdEncoding.DecodedLen(len(b64data)) > MAX_IMAGE_BYTES {
+			return nil, ValidationError{Message: "image too large"}
+		}
+
+		content, err := base64.StdEncoding.DecodeString(b64data)
+		if err != nil {
+			return nil, ValidationError{Message: "invalid base64 image"}
+		}
+		return content, nil
+	}
+
+	if source.ImageURL != "" {
+		return c.fetchDesign(ctx, source.ImageURL)
+	}
+
+	return nil, ValidationError{Message: "image, image_url or image_id is required"}
+}
+
+// fetchDesign downloads a design given by URL. The errors don't tell why the download failed,
+// so that the server can't be used to probe the hosts it reaches.
+func (c *Client) fetchDesign(ctx context.Context, imageURL string) ([]byte, error) {
+	u, err := url.Parse(imageURL)
+	if err != nil || checkImageURL(u, c.privateImageHosts) != nil {
+		return nil, ValidationError{Message: "invalid image url"}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, ValidationError{Message: "invalid image url"}
+	}
+
+	resp, err := c.imageClient.Do(req)
+	if err != nil {
+		slog.InfoContext(ctx, "unable to fetch image", "url", imageURL, "error", err)
+		return nil, ValidationError{Message: "unable to fetch image"}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		slog.InfoContext(ctx, "unable to fetch image", "url", imageURL, "status", resp.StatusCode)
+		return nil, ValidationError{Message: "unable to fetch image"}
+	}
+
+	if resp.ContentLength > MAX_IMAGE_BYTES {
+		return nil, ValidationError{Message: "image too large"}
+	}
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, MAX_IMAGE_BYTES+1))
+	if err != nil {
+		slog.InfoContext(ctx, "unable to fetch image", "url", imageURL, "error", err)
+		return nil, ValidationError{Message: "unable to fetch image"}
+	}
+
+	if len(content) > MAX_IMAGE_BYTES {
+		return nil, ValidationError{Message: "image too large"}
+	}
+
+	return content, nil
+}
+
+// newImageClient returns the client fetching the designs given by URL. Unless private is set, it only connects
+// to public addresses, checked once the host is resolved so that DNS rebinding can't get around it.
+func newImageClient(private bool) *http.Client {
+	dialer := &net.Dialer{Timeout: IMAGE_FETCH_TIMEOUT}
+	if !private {
+		dialer.Control = func(network string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return fmt.Errorf("address %s is not public", host)
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would be dialed instead of the image host
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   IMAGE_FETCH_TIMEOUT,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > MAX_IMAGE_REDIRECTS {
+				return errors.New("too many redirects")
+			}
+			return checkImageURL(req.URL, private)
+		},
+	}
+}
+
+// checkImageURL refuses the URLs which are not http or https, or whose host is an address that is not public
+func checkImageURL(u *url.URL, private bool) error {
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("image url must be http or https")
+	}
+
+	if ip := net.ParseIP(u.Hostname()); ip != nil && !private && !isPublicIP(ip) {
+		return fmt.Errorf("address %s is not public", ip)
+	}
+
+	return nil
+}
+
+// isPublicIP tells whether ip may be reached from the internet, cloud metadata services are link-local
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+
+	for _, network := range reservedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func scaleThumbnail(img image.Image) image.Image {
+	newWidth, newHeight := THUMBNAIL_SIZE, THUMBNAIL_SIZE
+	scaledImage := image.NewRGBA(image.Rect(0, 0, newWidth, newHeight))
+	srcRectangle := img.Bounds()
+	dstRectangle := scaledImage.Bounds()
+
+	scrWidth := srcRectangle.Dx()
+	scrHeigh := srcRectangle.Dy()
+
+	srcRatio := float64(scrWidth) / float64(scrHeigh)
+
+	if srcRatio > 1 {
+		// width > heigh
+		h := int(float64(newHeight) / srcRatio)
+		dstRectangle.Min.Y = (newHeight - h) / 2
+		dstRectangle.Max.Y = dstRectangle.Min.Y + h
+	} else if srcRatio < 1 {
+		// heigh > width
+		w := int(float64(newWidth) * srcRatio)
+		dstRectangle.Min.X = (newWidth - w) / 2
+		dstRectangle.Max.X = dstRectangle.Min.X + w
+	}
+
+	draw.CatmullRom.Scale(scaledImage, dstRectangle, img, srcRectangle, draw.Over, nil)
+
+	return scaledImage
+}
@@ -0,0 +1,139 @@
+package printful
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	for address, public := range map[string]bool{
+		"8.8.8.8":          true,
+		"2001:4860::8888":  true,
+		"127.0.0.1":        false,
+		"::1":              false,
+		"10.1.2.3":         false,
+		"172.16.0.1":       false,
+		"192.168.1.1":      false,
+		"169.254.169.254":  false,
+		"fe80::1":          false,
+		"fd00:ec2::254":    false,
+		"100.64.0.1":       false,
+		"0.0.0.0":          false,
+		"::ffff:127.0.0.1": false,
+	} {
+		if isPublicIP(net.ParseIP(address)) != public {
+			t.Errorf("isPublicIP(%s) should be %t", address, public)
+		}
+	}
+}
+
+func TestFetchDesignPrivateHosts(t *testing.T) {
+	hops := 0
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/design.png":
+			w.Write([]byte("design"))
+		case "/loop":
+			hops++
+			http.Redirect(w, r, "/loop?"+strconv.Itoa(hops), http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer remote.Close()
+
+	ctx := context.Background()
+	var validation ValidationError
+
+	public := NewClient()
+	for _, u := range []string{remote.URL + "/design.png", "http://169.254.169.254/latest/meta-data/", "http://[::1]/"} {
+		if _, err := public.fetchDesign(ctx, u); !errors.As(err, &validation) {
+			t.Errorf("%s should be refused, got %v", u, err)
+		}
+	}
+
+	private := NewClient(WithPrivateImageHosts())
+	if content, err := private.fetchDesign(ctx, remote.URL+"/design.png"); err != nil || string(content) != "design" {
+		t.Fatalf("a private host should be allowed by the option, got %v", err)
+	}
+
+	for _, path := range []string{"/missing", "/loop"} {
+		_, err := private.fetchDesign(ctx, remote.URL+path)
+		if !errors.As(err, &validation) || err.Error() != "unable to fetch image" {
+			t.Errorf("%s should fail with a generic error, got %v", path, err)
+		}
+	}
+	// The first request and the redirects followed
+	if hops != MAX_IMAGE_REDIRECTS+1 {
+		t.Errorf("the redirects should stop after %d hops, got %d requests", MAX_IMAGE_REDIRECTS, hops)
+	}
+
+	// Every hop is checked, a public host can't send the fetch to the metadata service
+	req := httptest.NewRequest("GET", "http://169.254.169.254/latest/meta-data/", nil)
+	if err := public.imageClient.CheckRedirect(req, []*http.Request{{}}); err == nil {
+		t.Error("a redirect to the metadata service should be refused")
+	}
+}
+
+// sizedImages serves every image id as a file of size bytes
+type sizedImages struct {
+	size int64
+}
+
+func (s sizedImages) UploadFile(ctx context.Context, filename string, content []byte) error {
+	return nil
+}
+
+func (s sizedImages) OpenFile(ctx context.Context, filename string) (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(make([]byte, s.size))), nil
+}
+
+func TestReadStoredDesignTooLarge(t *testing.T) {
+	ctx := context.Background()
+
+	content, err := NewClient(WithImageStore(sizedImages{size: MAX_IMAGE_BYTES})).readStoredDesign(ctx, "largest")
+	if err != nil || len(content) != MAX_IMAGE_BYTES {
+		t.Errorf("an image of the maximum size should be read whole, got %d bytes, %v", len(content), err)
+	}
+
+	_, err = NewClient(WithImageStore(sizedImages{size: MAX_IMAGE_BYTES + 1})).readStoredDesign(ctx, "oversized")
+	var validation ValidationError
+	if !errors.As(err, &validation) || err.Error() != "image too large" {
+		t.Errorf("an oversized image should be refused, got %v", err)
+	}
+}
+
+// failingImages fails to open every image with err
+type failingImages struct {
+	err error
+}
+
+func (f failingImages) UploadFile(ctx context.Context, filename string, content []byte) error {
+	return f.err
+}
+
+func (f failingImages) OpenFile(ctx context.Context, filename string) (io.ReadCloser, error) {
+	return nil, f.err
+}
+
+func TestReadStoredDesignErrors(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := NewClient(WithImageStore(failingImages{err: NotFoundError{Message: "file not found"}})).readStoredDesign(ctx, "missing")
+	if !errors.As(err, &NotFoundError{}) {
+		t.Errorf("a missing image should be not found, got %v", err)
+	}
+
+	outage := errors.New("server selection timeout")
+	_, err = NewClient(WithImageStore(failingImages{err: outage})).readStoredDesign(ctx, "unreachable")
+	if errors.As(err, &NotFoundError{}) || !errors.Is(err, outage) {
+		t.Errorf("a failure of the store should be returned as is, got %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package printful
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"printfulapi/src/metrics"
+	"printfulapi/src/model"
+	"sync/atomic"
+)
+
+// lookupStats counts the lookups of a kind of entry in the cache
+type lookupStats struct {
+	// Label of the lookups in the metrics
+	kind   string
+	hits   atomic.Int64
+	misses atomic.Int64
+	stale  atomic.Int64
+}
+
+// record counts a lookup, the cache returns a stale entry along with an error
+func (s *lookupStats) record(found bool, err error) {
+	result := "hit"
+	switch {
+	case err == nil:
+		s.hits.Add(1)
+	case found:
+		s.stale.Add(1)
+		result = "stale"
+	default:
+		s.misses.Add(1)
+		result = "miss"
+	}
+	metrics.CacheLookups.WithLabelValues(s.kind, result).Inc()
+}
+
+// WarmedUp tells whether the whole catalog went through the cache once
+func (c *Client) WarmedUp() bool {
+	return c.warmedUp.Load()
+}
+
+func (c *Client) CacheStats() model.CacheStats {
+	c.mockupTasksMutex.RLock()
+	mockupTasks := len(c.mockupTasks)
+	c.mockupTasksMutex.RUnlock()
+
+	return model.CacheStats{
+		ProductHits:   c.productLookups.hits.Load(),
+		ProductMisses: c.productLookups.misses.Load(),
+		ProductStale:  c.productLookups.stale.Load(),
+		VariantHits:   c.variantLookups.hits.Load(),
+		VariantMisses: c.variantLookups.misses.Load(),
+		VariantStale:  c.variantLookups.stale.Load(),
+		WarmedUp:      c.WarmedUp(),
+		MockupTasks:   mockupTasks,
+	}
+}
+
+// RateLimits returns the state of the rate limit of every endpoint called so far
+func (c *Client) RateLimits() []model.EndpointRateLimit {
+	return c.limiter.state()
+}
+
+// RetryBudget returns the retries calls can still make
+func (c *Client) RetryBudget() float64 {
+	return c.retryBudget.available()
+}
+
+// Ping checks Printful answers and accepts the access token, with a call which costs little
+func (c *Client) Ping(ctx context.Context) error {
+	resp, err := c.fetch(ctx, "GET", PRINTFUL_OAUTH_API, "/scopes", nil)
+	if err != nil {
+		var upstream UpstreamError
+		if errors.As(err, &upstream) && upstream.StatusCode == http.StatusUnauthorized {
+			return errors.New("printful refused the access token")
+		}
+		return err
+	}
+	resp.Body.Close()
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package printful
+
+import (
+	"fmt"
+	"time"
+)
+
+// NotFoundError is returned when Printful or the images bucket don't know the requested resource
+type NotFoundError struct {
+	Message string
+}
+
+func (e NotFoundError) Error() string {
+	return e.Message
+}
+
+// ValidationError is returned when a request can't be sent to Printful as is
+type ValidationError struct {
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return e.Message
+}
+
+// ConflictError is returned when the same order is already being sent to Printful
+type ConflictError struct {
+	Message string
+}
+
+func (e ConflictError) Error() string {
+	return e.Message
+}
+
+// RateLimitedError is returned when Printful still answers 429 after waiting
+type RateLimitedError struct {
+	RetryAfter time.Duration
+}
+
+func (e RateLimitedError) Error() string {
+	return "printful rate limit exceeded"
+}
+
+// UpstreamError is returned when Printful can't be reached or answers with an error.
+// StatusCode is 0 when no answer was received.
+type UpstreamError struct {
+	StatusCode int
+	// Printful error code, reason and message, as found in the response body
+	Code    int
+	Reason  string
+	Message string
+	Err     error
+}
+
+func (e UpstreamError) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+
+	return fmt.Sprintf("printful returned HTTP status code: %d: %s", e.StatusCode, e.Message)
+}
+
+func (e UpstreamError) Unwrap() error {
+	return e.Err
+}
+
+// printfulErrorResponse is the body of a Printful reply other than 200
+type printfulErrorResponse struct {
+	Code   int         `json:"code"`
+	Result interface{} `json:"result"`
+	Error  struct {
+		Reason  string `json:"reason"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// PartialUpdateError is returned when a change applied variant by variant fails part way,
+// SyncVariantIDs lists the variants already updated
+type PartialUpdateError struct {
+	SyncVariantIDs []int64
+	Err            error
+}
+
+func (e PartialUpdateError) Error() string {
+	return fmt.Sprintf("sync variants %v were updated before the failure: %v", e.SyncVariantIDs, e.Err)
+}
+
+func (e PartialUpdateError) Unwrap() error {
+	return e.Err
+}
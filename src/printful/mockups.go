@@ -0,0 +1,313 @@
+package printful
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"printfulapi/src/model"
+	"strconv"
+	"time"
+
+	"github.com/baldurstod/randstr"
+)
+
+const defaultTaskInterval = 10000
+
+// Polls of a mockup task before it is given up as failed
+const MAX_MOCKUP_POLLS = 90
+
+const MAX_MOCKUP_BYTES = MAX_IMAGE_BYTES
+
+// Time a completed or failed mockup task is still answered by this server
+const MOCKUP_TASK_TTL = time.Hour
+
+// trackedMockupTask is a task known to this server, ended is zero until the task completes or fails
+type trackedMockupTask struct {
+	task  *model.MockupTask
+	ended time.Time
+}
+
+func (t *trackedMockupTask) expired(now time.Time) bool {
+	return !t.ended.IsZero() && now.Sub(t.ended) > MOCKUP_TASK_TTL
+}
+
+type MockupTaskResponse struct {
+	Code   int              `json:"code"`
+	Result model.MockupTask `json:"result"`
+}
+
+// CreateMockupTask submits a mockup generation task and starts polling it in the background.
+// When SimulateMockup is set, Printful is not called and a completed task is answered locally
+// under the key SimulateTaskKey, or a generated key when it is unset.
+func (c *Client) CreateMockupTask(ctx context.Context, datas model.CreateMockupTask) (*model.MockupTask, error) {
+	if c.config.SimulateMockup {
+		return c.simulateMockupTask(datas)
+	}
+
+	task, err := c.createMockupTask(ctx, datas)
+	if err != nil {
+		return nil, err
+	}
+
+	c.startMockupTask(task)
+
+	return task, nil
+}
+
+func (c *Client) createMockupTask(ctx context.Context, datas model.CreateMockupTask) (*model.MockupTask, error) {
+	body := map[string]interface{}{
+		"variant_ids": datas.VariantIDs,
+		"files":       datas.Files,
+	}
+	if datas.Format != "" {
+		body["format"] = datas.Format
+	}
+
+	resp, err := c.fetch(ctx, "POST", PRINTFUL_MOCKUP_GENERATOR_API_CREATE_TASK, "/"+strconv.Itoa(datas.ProductID), body)
+	if err != nil {
+		slog.WarnContext(ctx, "printful call failed", "error", err)
+		return nil, fmt.Errorf("unable to get printful response: <%w>", err)
+	}
+	defer resp.Body.Close()
+
+	response := MockupTaskResponse{}
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to decode printful response", "error", err)
+		return nil, errors.New("unable to decode printful response")
+	}
+
+	return &response.Result, nil
+}
+
+// simulateMockupTask answers a completed task with the shape Printful gives, the designs standing for the mockups
+func (c *Client) simulateMockupTask(datas model.CreateMockupTask) (*model.MockupTask, error) {
+	taskKey := c.config.SimulateTaskKey
+	if taskKey == "" {
+		taskKey = "simulated-" + randstr.String(16)
+	}
+
+	task := &model.MockupTask{
+		TaskKey:    taskKey,
+		Status:     "completed",
+		Mockups:    make([]model.Mockup, 0, len(datas.Files)),
+		Printfiles: make([]model.MockupPrintfile, 0, len(datas.Files)),
+		Files:      []string{},
+	}
+	for _, file := range datas.Files {
+		task.Mockups = append(task.Mockups, model.Mockup{
+			Placement:  file.Placement,
+			VariantIDs: datas.VariantIDs,
+			MockupURL:  file.ImageURL,
+			Extra:      []model.MockupExtra{},
+		})
+		task.Printfiles = append(task.Printfiles, model.MockupPrintfile{
+			VariantIDs: datas.VariantIDs,
+			Placement:  file.Placement,
+			URL:        file.ImageURL,
+		})
+	}
+
+	c.mockupTasksMutex.Lock()
+	c.storeMockupTask(task.TaskKey, task)
+	c.mockupTasksMutex.Unlock()
+
+	return task, nil
+}
+
+// GetMockupTask returns the state of a task tracked by this server or, failing that, asks Printful
+func (c *Client) GetMockupTask(ctx context.Context, taskKey string) (*model.MockupTask, error) {
+	c.mockupTasksMutex.RLock()
+	tracked, ok := c.mockupTasks[taskKey]
+	c.mockupTasksMutex.RUnlock()
+	if ok && !tracked.expired(time.Now()) {
+		return tracked.task, nil
+	}
+
+	if c.config.SimulateMockup {
+		return nil, NotFoundError{Message: "mockup task " + taskKey + " not found"}
+	}
+
+	return c.fetchMockupTask(ctx, taskKey)
+}
+
+func (c *Client) fetchMockupTask(ctx context.Context, taskKey string) (*model.MockupTask, error) {
+	resp, err := c.fetch(ctx, "GET", PRINTFUL_MOCKUP_GENERATOR_API, "/task?task_key="+url.QueryEscape(taskKey), nil)
+	if err != nil {
+		slog.WarnContext(ctx, "printful call failed", "error", err)
+		return nil, fmt.Errorf("unable to get printful response: <%w>", err)
+	}
+	defer resp.Body.Close()
+
+	response := MockupTaskResponse{}
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to decode printful response", "error", err)
+		return nil, errors.New("unable to decode printful response")
+	}
+
+	if response.Code != 200 {
+		return nil, UpstreamError{StatusCode: resp.StatusCode, Code: response.Code, Message: "printful returned an error"}
+	}
+
+	return &response.Result, nil
+}
+
+func (c *Client) startMockupTask(task *model.MockupTask) {
+	c.mockupTasksMutex.Lock()
+	defer c.mockupTasksMutex.Unlock()
+
+	if previous, ok := c.mockupTasks[task.TaskKey]; ok && previous.task.Status != "failed" && !previous.expired(time.Now()) {
+		// A task already tracked is not polled and downloaded again
+		*task = *previous.task
+		return
+	}
+
+	c.storeMockupTask(task.TaskKey, task)
+	// The task outlives the request which created it, but not the client.
+	// Polls give way to the interactive calls.
+	c.goBackground(func(ctx context.Context) {
+		c.pollMockupTask(withBackgroundPriority(ctx), task.TaskKey)
+	})
+}
+
+// storeMockupTask tracks task under taskKey and forgets the tasks ended more than MOCKUP_TASK_TTL ago,
+// the caller holds mockupTasksMutex
+func (c *Client) storeMockupTask(taskKey string, task *model.MockupTask) {
+	now := time.Now()
+	for key, tracked := range c.mockupTasks {
+		if tracked.expired(now) {
+			delete(c.mockupTasks, key)
+		}
+	}
+
+	tracked := &trackedMockupTask{task: task}
+	if task.Status == "completed" || task.Status == "failed" {
+		tracked.ended = now
+	}
+	c.mockupTasks[taskKey] = tracked
+}
+
+// pollMockupTask waits for a task to end, it is recorded as failed when Printful doesn't know it
+// or when it hasn't ended after MAX_MOCKUP_POLLS polls
+func (c *Client) pollMockupTask(ctx context.Context, taskKey string) {
+	interval := c.config.TaskInterval
+	if interval <= 0 {
+		interval = defaultTaskInterval
+	}
+
+	for poll := 1; ; poll++ {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Duration(interval) * time.Millisecond):
+		}
+
+		task, err := c.fetchMockupTask(ctx, taskKey)
+		if errors.As(err, &NotFoundError{}) {
+			c.failMockupTask(ctx, taskKey, "mockup task not found")
+			return
+		}
+		if err != nil {
+			slog.WarnContext(ctx, "unable to poll mockup task", "task_key", taskKey, "error", err)
+		}
+		if err != nil || (task.Status != "completed" && task.Status != "failed") {
+			if poll >= MAX_MOCKUP_POLLS {
+				c.failMockupTask(ctx, taskKey, fmt.Sprintf("mockup task not finished after %d polls", poll))
+				return
+			}
+			continue
+		}
+
+		switch task.Status {
+		case "completed":
+			task.Files = c.downloadMockups(ctx, task)
+		case "failed":
+			slog.WarnContext(ctx, "mockup task failed", "task_key", taskKey, "task_error", task.Error)
+		}
+
+		c.mockupTasksMutex.Lock()
+		c.storeMockupTask(taskKey, task)
+		c.mockupTasksMutex.Unlock()
+		return
+	}
+}
+
+func (c *Client) failMockupTask(ctx context.Context, taskKey string, reason string) {
+	slog.WarnContext(ctx, "mockup task given up", "task_key", taskKey, "reason", reason)
+
+	c.mockupTasksMutex.Lock()
+	defer c.mockupTasksMutex.Unlock()
+
+	c.storeMockupTask(taskKey, &model.MockupTask{TaskKey: taskKey, Status: "failed", Error: reason})
+}
+
+func (c *Client) downloadMockups(ctx context.Context, task *model.MockupTask) []string {
+	files := make([]string, 0, len(task.Mockups))
+	for i, mockup := range task.Mockups {
+		filename := fmt.Sprintf("%s_%s_%d%s", task.TaskKey, mockup.Placement, i, mockupExtension(mockup.MockupURL))
+		if err := c.downloadMockup(ctx, mockup.MockupURL, filename); err != nil {
+			slog.WarnContext(ctx, "unable to download mockup", "filename", filename, "error", err)
+			continue
+		}
+		files = append(files, filename)
+	}
+
+	return files
+}
+
+func (c *Client) downloadMockup(ctx context.Context, mockupURL string, filename string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", mockupURL, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("unable to download mockup %s: HTTP status code %d", mockupURL, resp.StatusCode)
+	}
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, MAX_MOCKUP_BYTES+1))
+	if err != nil {
+		return err
+	}
+	if len(content) > MAX_MOCKUP_BYTES {
+		return fmt.Errorf("mockup %s is larger than %d bytes", mockupURL, MAX_MOCKUP_BYTES)
+	}
+
+	if c.config.MockupDirectory == "" {
+		if c.images == nil {
+			return errors.New("no image store configured")
+		}
+		return c.images.UploadFile(ctx, filename, content)
+	}
+
+	err = os.MkdirAll(c.config.MockupDirectory, 0755)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(c.config.MockupDirectory, filename), content, 0644)
+}
+
+func mockupExtension(mockupURL string) string {
+	u, err := url.Parse(mockupURL)
+	if err != nil {
+		return ""
+	}
+
+	return path.Ext(u.Path)
+}
@@ -0,0 +1,132 @@
+package printful
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"printfulapi/src/config"
+	"printfulapi/src/model"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSimulateMockupTask(t *testing.T) {
+	calls := atomic.Int32{}
+	printful := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.NotFound(w, r)
+	}))
+	defer printful.Close()
+
+	c := NewClient(WithConfig(config.Printful{SimulateMockup: true, SimulateTaskKey: "simulated"}), WithBaseURL(printful.URL))
+	ctx := context.Background()
+
+	created, err := c.CreateMockupTask(ctx, model.CreateMockupTask{
+		ProductID:  71,
+		VariantIDs: []int{4011, 4012},
+		Files:      []model.MockupFile{{Placement: "front", ImageURL: "https://example.com/design.png"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.TaskKey != "simulated" || created.Status != "completed" || len(created.Mockups) != 1 ||
+		created.Mockups[0].MockupURL != "https://example.com/design.png" || len(created.Mockups[0].VariantIDs) != 2 {
+		t.Errorf("unexpected simulated task %+v", created)
+	}
+
+	task, err := c.GetMockupTask(ctx, "simulated")
+	if err != nil || task.Status != "completed" {
+		t.Errorf("the simulated task should be found, got %+v, %v", task, err)
+	}
+	if _, err = c.GetMockupTask(ctx, "unknown"); !errors.As(err, &NotFoundError{}) {
+		t.Errorf("an unknown task should be not found, got %v", err)
+	}
+
+	// Without a configured key, each simulated task gets its own
+	c = NewClient(WithConfig(config.Printful{SimulateMockup: true}), WithBaseURL(printful.URL))
+	generated, err := c.CreateMockupTask(ctx, model.CreateMockupTask{ProductID: 71, VariantIDs: []int{4011}})
+	if err != nil || generated.TaskKey == "" {
+		t.Fatalf("a task key should be generated, got %+v, %v", generated, err)
+	}
+	if task, err = c.GetMockupTask(ctx, generated.TaskKey); err != nil || task.Status != "completed" {
+		t.Errorf("the generated task should be found, got %+v, %v", task, err)
+	}
+
+	if calls.Load() != 0 {
+		t.Errorf("printful should not be called, got %d calls", calls.Load())
+	}
+}
+
+func TestPollMockupTaskGivesUp(t *testing.T) {
+	polls := atomic.Int32{}
+	printful := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("task_key") != "pending" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code":404,"result":"Task not found","error":{"reason":"NotFound","message":"Task not found"}}`))
+			return
+		}
+		polls.Add(1)
+		w.Write([]byte(`{"code":200,"result":{"task_key":"pending","status":"pending"}}`))
+	}))
+	defer printful.Close()
+
+	c := NewClient(WithConfig(config.Printful{TaskInterval: 1}), WithBaseURL(printful.URL))
+	defer c.Close(context.Background())
+
+	for _, key := range []string{"pending", "unknown"} {
+		c.startMockupTask(&model.MockupTask{TaskKey: key, Status: "pending"})
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for _, key := range []string{"pending", "unknown"} {
+		for {
+			task, err := c.GetMockupTask(context.Background(), key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if task.Status == "failed" {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("task %s should be given up, got %+v", key, task)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	if polls.Load() != MAX_MOCKUP_POLLS {
+		t.Errorf("a pending task should be polled %d times, got %d", MAX_MOCKUP_POLLS, polls.Load())
+	}
+}
+
+func TestMockupTasksExpire(t *testing.T) {
+	c := NewClient(WithConfig(config.Printful{SimulateMockup: true}))
+	ctx := context.Background()
+
+	c.mockupTasksMutex.Lock()
+	c.storeMockupTask("old", &model.MockupTask{TaskKey: "old", Status: "completed"})
+	c.storeMockupTask("running", &model.MockupTask{TaskKey: "running", Status: "pending"})
+	c.mockupTasks["old"].ended = time.Now().Add(-MOCKUP_TASK_TTL - time.Second)
+	c.mockupTasksMutex.Unlock()
+
+	if _, err := c.GetMockupTask(ctx, "old"); !errors.As(err, &NotFoundError{}) {
+		t.Errorf("an expired task should be not found, got %v", err)
+	}
+	if _, err := c.GetMockupTask(ctx, "running"); err != nil {
+		t.Errorf("a running task should not expire, got %v", err)
+	}
+
+	// Tracking a new task forgets the expired ones
+	if _, err := c.CreateMockupTask(ctx, model.CreateMockupTask{ProductID: 71, VariantIDs: []int{4011}}); err != nil {
+		t.Fatal(err)
+	}
+	c.mockupTasksMutex.RLock()
+	_, old := c.mockupTasks["old"]
+	tracked := len(c.mockupTasks)
+	c.mockupTasksMutex.RUnlock()
+	if old || tracked != 2 {
+		t.Errorf("the expired task should be forgotten, %d tasks tracked", tracked)
+	}
+}
@@ -0,0 +1,330 @@
+package printful
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"printfulapi/src/model"
+	"strconv"
+	"time"
+
+	"github.com/baldurstod/printful-api-model/schemas"
+	"github.com/mitchellh/mapstructure"
+)
+
+type ListOrdersResponse struct {
+	Code   int             `json:"code"`
+	Result []schemas.Order `json:"result"`
+	Paging model.Paging    `json:"paging"`
+}
+
+type EstimateOrderCostsResponse struct {
+	Code   int              `json:"code"`
+	Result model.OrderCosts `json:"result"`
+}
+
+// Printful refuses longer external ids
+const MAX_EXTERNAL_ID_LENGTH = 32
+
+// Time given to record the outcome of a submission, which is done even when the request has ended
+const ORDER_SUBMISSION_RECORD_TIMEOUT = 5 * time.Second
+
+// CreateOrder sends an order to Printful once per external id, which the client must give.
+// When an external id was already submitted with the same content, the order created for it is returned
+// rather than a new one.
+func (c *Client) CreateOrder(ctx context.Context, request model.CreateOrderRequest) (*schemas.Order, error) {
+	order := request.Order
+	if order.ExternalID == "" {
+		return nil, ValidationError{Message: "external_id is required"}
+	}
+	if len(order.ExternalID) > MAX_EXTERNAL_ID_LENGTH {
+		return nil, ValidationError{Message: fmt.Sprintf("external_id must be at most %d characters", MAX_EXTERNAL_ID_LENGTH)}
+	}
+
+	now := time.Now()
+	submission := &model.OrderSubmission{
+		ExternalID: order.ExternalID,
+		Hash:       orderHash(order),
+		Status:     model.ORDER_SUBMISSION_PENDING,
+		Created:    now,
+		Updated:    now,
+	}
+
+	previous, err := c.submissions.InsertOrderSubmission(ctx, submission)
+	if err != nil {
+		return nil, err
+	}
+
+	if previous != nil {
+		if previous.Hash != submission.Hash {
+			return nil, ValidationError{Message: "external_id " + order.ExternalID + " was already used for another order"}
+		}
+
+		existing, err := c.findOrder(ctx, order.ExternalID)
+		if err != nil || existing != nil {
+			return existing, err
+		}
+
+		// A pending submission younger than a call may still reach Printful
+		if previous.Status == model.ORDER_SUBMISSION_PENDING && now.Sub(previous.Updated) < c.timeout() {
+			return nil, ConflictError{Message: "order " + order.ExternalID + " is already being submitted"}
+		}
+
+		// The previous submission never reached Printful, it is sent again
+		submission = previous
+		submission.Status = model.ORDER_SUBMISSION_PENDING
+		submission.Updated = now
+		if err := c.submissions.UpdateOrderSubmission(ctx, submission); err != nil {
+			return nil, err
+		}
+	}
+
+	created, err := c.postOrder(ctx, order)
+	if isDuplicateExternalID(err) {
+		// Printful knows the external id from a submission older than its record
+		created, err = c.findDuplicate(ctx, order.ExternalID, submission.Hash, err)
+	}
+
+	// A submission left pending would hold the external id until it is old enough to be sent again
+	recordCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), ORDER_SUBMISSION_RECORD_TIMEOUT)
+	defer cancel()
+
+	if err != nil {
+		if deleteErr := c.submissions.DeleteOrderSubmission(recordCtx, order.ExternalID); deleteErr != nil {
+			slog.ErrorContext(ctx, "unable to forget order submission", "external_id", order.ExternalID, "error", deleteErr)
+		}
+		return nil, err
+	}
+
+	submission.Status = model.ORDER_SUBMISSION_CREATED
+	submission.OrderID = created.ID
+	submission.Updated = time.Now()
+	if err := c.submissions.UpdateOrderSubmission(recordCtx, submission); err != nil {
+		// The order exists, Printful will refuse its external id if it is submitted again
+		slog.ErrorContext(ctx, "unable to record order submission", "external_id", order.ExternalID, "error", err)
+	}
+
+	return created, nil
+}
+
+// findOrder returns nil when Printful knows no order with this external id
+func (c *Client) findOrder(ctx context.Context, externalID string) (*schemas.Order, error) {
+	order, err := c.GetOrder(ctx, model.OrderReference{ExternalID: externalID})
+	if errors.As(err, &NotFoundError{}) {
+		return nil, nil
+	}
+
+	return order, err
+}
+
+// findDuplicate returns the order Printful has for an external id when its content is the one submitted
+func (c *Client) findDuplicate(ctx context.Context, externalID string, hash string, postErr error) (*schemas.Order, error) {
+	existing, err := c.findOrder(ctx, externalID)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return nil, postErr
+	}
+	if orderHash(*existing) != hash {
+		return nil, ValidationError{Message: "external_id " + externalID + " was already used for another order"}
+	}
+
+	return existing, nil
+}
+
+// isDuplicateExternalID tells whether Printful refused an order because its external id is already used,
+// which it answers with a 409 conflict
+func isDuplicateExternalID(err error) bool {
+	var upstream UpstreamError
+	if !errors.As(err, &upstream) {
+		return false
+	}
+
+	return upstream.StatusCode == http.StatusConflict || upstream.Code == http.StatusConflict
+}
+
+// orderHash hashes what the customer ordered: the recipient and the items.
+// It is the same for an order sent and for the order Printful answers with, which adds its own fields.
+func orderHash(order schemas.Order) string {
+	type item struct {
+		ExternalID                string `json:"external_id"`
+		VariantID                 int64  `json:"variant_id"`
+		SyncVariantID             int64  `json:"sync_variant_id"`
+		ExternalVariantID         string `json:"external_variant_id"`
+		WarehouseProductVariantID int64  `json:"warehouse_product_variant_id"`
+		ProductTemplateID         int64  `json:"product_template_id"`
+		Quantity                  int    `json:"quantity"`
+	}
+	content := struct {
+		Recipient schemas.Address `json:"recipient"`
+		Items     []item          `json:"items"`
+	}{Recipient: order.Recipient, Items: make([]item, 0, len(order.Items))}
+
+	content.Recipient.CountryName = ""
+	content.Recipient.StateName = ""
+	for _, i := range order.Items {
+		content.Items = append(content.Items, item{
+			ExternalID:                i.ExternalID,
+			VariantID:                 i.VariantID,
+			SyncVariantID:             i.SyncVariantID,
+			ExternalVariantID:         i.ExternalVariantID,
+			WarehouseProductVariantID: i.WarehouseProductVariantID,
+			ProductTemplateID:         i.ProductTemplateID,
+			Quantity:                  i.Quantity,
+		})
+	}
+
+	encoded, _ := json.Marshal(content)
+	sum := sha256.Sum256(encoded)
+
+	return hex.EncodeToString(sum[:])
+}
+
+func orderPath(ref model.OrderReference) (string, error) {
+	if ref.ExternalID != "" {
+		return "/@" + url.PathEscape(ref.ExternalID), nil
+	}
+
+	if ref.OrderID > 0 {
+		return "/" + strconv.FormatInt(ref.OrderID, 10), nil
+	}
+
+	return "", ValidationError{Message: "order_id or external_id is required"}
+}
+
+func (c *Client) fetchOrder(ctx context.Context, method string, path string, body map[string]interface{}) (*schemas.Order, error) {
+	resp, err := c.fetch(ctx, method, PRINTFUL_ORDERS_API, path, body)
+	if err != nil {
+		slog.WarnContext(ctx, "printful call failed", "error", err)
+		return nil, fmt.Errorf("unable to get printful response: <%w>", err)
+	}
+	defer resp.Body.Close()
+
+	response := CreateOrderResponse{}
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to decode printful response", "error", err)
+		return nil, errors.New("unable to decode printful response")
+	}
+
+	return &response.Result, nil
+}
+
+func (c *Client) GetOrder(ctx context.Context, ref model.OrderReference) (*schemas.Order, error) {
+	path, err := orderPath(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.fetchOrder(ctx, "GET", path, nil)
+}
+
+func (c *Client) ListOrders(ctx context.Context, request model.ListOrdersRequest) ([]schemas.Order, *model.Paging, error) {
+	query := url.Values{}
+	if request.Status != "" {
+		query.Set("status", request.Status)
+	}
+	if request.Offset > 0 {
+		query.Set("offset", strconv.Itoa(request.Offset))
+	}
+	if request.Limit > 0 {
+		query.Set("limit", strconv.Itoa(request.Limit))
+	}
+
+	resp, err := c.fetch(ctx, "GET", PRINTFUL_ORDERS_API, "?"+query.Encode(), nil)
+	if err != nil {
+		slog.WarnContext(ctx, "printful call failed", "error", err)
+		return nil, nil, fmt.Errorf("unable to get printful response: <%w>", err)
+	}
+	defer resp.Body.Close()
+
+	response := ListOrdersResponse{}
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to decode printful response", "error", err)
+		return nil, nil, errors.New("unable to decode printful response")
+	}
+
+	return response.Result, &response.Paging, nil
+}
+
+// UpdateOrder modifies a draft or failed order, and optionally submits it for fulfillment
+func (c *Client) UpdateOrder(ctx context.Context, request model.UpdateOrderRequest) (*schemas.Order, error) {
+	path, err := orderPath(request.OrderReference)
+	if err != nil {
+		return nil, err
+	}
+
+	order := map[string]interface{}{}
+	err = mapstructure.Decode(request.Order, &order)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to encode the printful request", "error", err)
+		return nil, errors.New("error while decoding request")
+	}
+
+	// The fields left out keep their value, the zero value of the others would replace it
+	body := map[string]interface{}{}
+	for _, field := range request.Fields {
+		if value, ok := order[field]; ok {
+			body[field] = value
+		}
+	}
+
+	if request.Confirm {
+		path += "?confirm=true"
+	}
+
+	return c.fetchOrder(ctx, "PUT", path, body)
+}
+
+// ConfirmOrder submits a draft order for fulfillment
+func (c *Client) ConfirmOrder(ctx context.Context, ref model.OrderReference) (*schemas.Order, error) {
+	path, err := orderPath(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.fetchOrder(ctx, "POST", path+"/confirm", nil)
+}
+
+// CancelOrder cancels a pending or draft order
+func (c *Client) CancelOrder(ctx context.Context, ref model.OrderReference) (*schemas.Order, error) {
+	path, err := orderPath(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.fetchOrder(ctx, "DELETE", path, nil)
+}
+
+func (c *Client) EstimateOrderCosts(ctx context.Context, request model.EstimateOrderCostsRequest) (*model.OrderCosts, error) {
+	body := map[string]interface{}{}
+	err := mapstructure.Decode(request.Order, &body)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to encode the printful request", "error", err)
+		return nil, errors.New("error while decoding request")
+	}
+
+	resp, err := c.fetch(ctx, "POST", PRINTFUL_ORDERS_API, "/estimate-costs", body, idempotent())
+	if err != nil {
+		slog.WarnContext(ctx, "printful call failed", "error", err)
+		return nil, fmt.Errorf("unable to get printful response: <%w>", err)
+	}
+	defer resp.Body.Close()
+
+	response := EstimateOrderCostsResponse{}
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to decode printful response", "error", err)
+		return nil, errors.New("unable to decode printful response")
+	}
+
+	return &response.Result, nil
+}
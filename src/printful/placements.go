@@ -0,0 +1,107 @@
+package printful
+
+import (
+	"fmt"
+	"printfulapi/src/model"
+	"strings"
+
+	printfulAPIModel "github.com/baldurstod/printful-api-model"
+)
+
+// Printful accepts "default" for the main placement of a product
+const DEFAULT_PLACEMENT = "default"
+
+// findPrintfile returns the printfile of a variant for a placement, or nil if the variant can't be printed there
+func findPrintfile(printfileInfo *printfulAPIModel.PrintfileInfo, variantID int, placement string) *printfulAPIModel.Printfile {
+	for _, v := range printfileInfo.VariantPrintfiles {
+		if v.VariantID != variantID {
+			continue
+		}
+
+		placements, ok := v.Placements.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+
+		printfileID, ok := placements[placement]
+		if !ok && placement == DEFAULT_PLACEMENT {
+			printfileID, ok = placements["front"]
+		}
+		if !ok {
+			return nil
+		}
+
+		id, ok := printfileID.(float64)
+		if !ok {
+			return nil
+		}
+
+		for i, p := range printfileInfo.Printfiles {
+			if p.PrintfileID == int(id) {
+				return &printfileInfo.Printfiles[i]
+			}
+		}
+		return nil
+	}
+
+	return nil
+}
+
+// syncProductFiles returns the files of a create-sync-product request, the legacy single image
+// being printed on the default placement
+func syncProductFiles(datas model.CreateSyncProductDatas) []model.SyncProductFile {
+	if len(datas.Files) > 0 {
+		return datas.Files
+	}
+
+	if datas.Image == "" {
+		return nil
+	}
+
+	return []model.SyncProductFile{{Type: DEFAULT_PLACEMENT, DesignSource: model.DesignSource{Image: datas.Image}}}
+}
+
+// validatePlacements checks every file can be printed on every variant of the request
+func validatePlacements(printfileInfo *printfulAPIModel.PrintfileInfo, variantIDs []int, files []model.SyncProductFile) error {
+	if len(files) == 0 {
+		return ValidationError{Message: "at least one file is required"}
+	}
+
+	if len(variantIDs) == 0 {
+		return ValidationError{Message: "at least one variant is required"}
+	}
+
+	problems := []string{}
+	seen := make(map[string]bool)
+	for _, file := range files {
+		if file.Type == "" {
+			problems = append(problems, "file type is required")
+			continue
+		}
+
+		if seen[file.Type] {
+			problems = append(problems, fmt.Sprintf("placement %s is used more than once", file.Type))
+		}
+		seen[file.Type] = true
+
+		if isDesignSourceEmpty(file.DesignSource) {
+			problems = append(problems, fmt.Sprintf("placement %s has no image", file.Type))
+		}
+
+		if p := file.Position; p != nil && (p.AreaWidth <= 0 || p.AreaHeight <= 0 || p.Width <= 0 || p.Height <= 0) {
+			problems = append(problems, fmt.Sprintf("placement %s has an invalid position", file.Type))
+		}
+
+		for _, variantID := range variantIDs {
+			if findPrintfile(printfileInfo, variantID, file.Type) == nil {
+				problems = append(problems, fmt.Sprintf("placement %s is not available for variant %d", file.Type, variantID))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return ValidationError{Message: strings.Join(problems, ", ")}
+	}
+
+	return nil
+}
@@ -1,6 +1,7 @@
 package printful
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,147 +11,33 @@ import (
 	"github.com/baldurstod/printful-api-model/schemas"
 
 	//"io/ioutil"
-	"bytes"
-	"encoding/base64"
-	"image"
-	"image/png"
-	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
-	"printfulapi/src/config"
 	"printfulapi/src/model"
-	"printfulapi/src/mongo"
 	"strconv"
-	"strings"
-	"sync"
 	"time"
 
-	"github.com/baldurstod/randstr"
 	"github.com/mitchellh/mapstructure"
-	"golang.org/x/image/draw"
 )
 
-var printfulConfig config.Printful
+// InitAllProducts warms the product cache with the whole catalog, until ctx ends.
+// Its calls wait for the interactive ones, so warming never delays a client.
+func (c *Client) InitAllProducts(ctx context.Context) error {
+	ctx = withBackgroundPriority(ctx)
 
-func SetPrintfulConfig(config config.Printful) {
-	printfulConfig = config
-	log.Println(config)
-	go initAllProducts()
-}
-
-const PRINTFUL_PRODUCTS_API = "https://api.printful.com/products"
-const PRINTFUL_STORE_API = "https://api.printful.com/store"
-const PRINTFUL_MOCKUP_GENERATOR_API = "https://api.printful.com/mockup-generator"
-const PRINTFUL_MOCKUP_GENERATOR_API_CREATE_TASK = "https://api.printful.com/mockup-generator/create-task"
-const PRINTFUL_COUNTRIES_API = "https://api.printful.com/countries"
-const PRINTFUL_ORDERS_API = "https://api.printful.com/orders"
-const PRINTFUL_SHIPPING_API = "https://api.printful.com/shipping"
-const PRINTFUL_TAX_API = "https://api.printful.com/tax"
-
-var mutexPerEndpoint = make(map[string]*sync.Mutex)
-
-func addEndPoint(endPoint string) int {
-	mutexPerEndpoint[endPoint] = &sync.Mutex{}
-	return 0
-}
-
-var _ = addEndPoint(PRINTFUL_PRODUCTS_API)
-var _ = addEndPoint(PRINTFUL_STORE_API)
-var _ = addEndPoint(PRINTFUL_MOCKUP_GENERATOR_API)
-var _ = addEndPoint(PRINTFUL_MOCKUP_GENERATOR_API_CREATE_TASK)
-var _ = addEndPoint(PRINTFUL_COUNTRIES_API)
-var _ = addEndPoint(PRINTFUL_ORDERS_API)
-var _ = addEndPoint(PRINTFUL_SHIPPING_API)
-var _ = addEndPoint(PRINTFUL_TAX_API)
-
-func fetchRateLimited(method string, apiURL string, path string, headers map[string]string, body map[string]interface{}) (*http.Response, error) {
-	mutex := mutexPerEndpoint[apiURL]
-
-	mutex.Lock()
-	defer mutex.Unlock()
-
-	u, err := url.JoinPath(apiURL, path)
-	if err != nil {
-		return nil, errors.New("unable to create URL")
-	}
-
-	var requestBody io.Reader
-	if body != nil {
-		out, err := json.Marshal(body)
-		if err != nil {
-			return nil, err
-		}
-		requestBody = bytes.NewBuffer(out)
-	}
-
-	var resp *http.Response
-	for i := 0; i < 10; i++ {
-
-		req, err := http.NewRequest(method, u, requestBody)
-		if err != nil {
-			return nil, err
-		}
-
-		for k, v := range headers {
-			req.Header.Add(k, v)
-		}
-
-		resp, err = http.DefaultClient.Do(req)
-		if err != nil {
-			return nil, err
-		}
-
-		if resp.StatusCode == 429 { //Too Many Requests
-			time.Sleep(60 * time.Second)
-			continue
-		}
-
-		if resp.StatusCode != 200 { //Everything except 429 and 200
-			return nil, fmt.Errorf("printful returned HTTP status code: %d", resp.StatusCode)
-		}
-		break
-	}
-
-	header := resp.Header
-	remaining := header.Get("X-RateLimit-Remaining")
-	if remaining == "" {
-		return resp, err
-	}
-
-	remain, err := strconv.Atoi(remaining)
-	if err != nil {
-		return nil, errors.New("unable to get rate limit")
-	}
-
-	reset, err := strconv.Atoi(header.Get("X-Ratelimit-Reset"))
-	if err != nil {
-		reset = 60 // default to 60s
-		err = nil
-	}
-
-	if remain < 1 {
-		reset += 2
-		time.Sleep(time.Duration(reset) * time.Second)
-	}
-
-	return resp, err
-}
-
-func initAllProducts() error {
-	products, err := GetProducts()
+	products, err := c.GetProducts(ctx)
 	if err != nil {
 		return err
 	}
 
 	for _, v := range products {
-		_, err, fromPrintful := GetProduct(v.ID)
-		if err != nil {
-			log.Println(err)
+		_, err, _ := c.GetProduct(ctx, v.ID)
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
-		if fromPrintful {
-			// printful product API has a rate of 30/min
-			time.Sleep(3 * time.Second)
+		if err != nil {
+			slog.WarnContext(ctx, "unable to warm product", "product_id", v.ID, "error", err)
 		}
 	}
 	return nil
@@ -161,17 +48,17 @@ type GetCountriesResponse struct {
 	Result []printfulAPIModel.Country `json:"result"`
 }
 
-func GetCountries() ([]printfulAPIModel.Country, error) {
-	resp, err := fetchRateLimited("GET", PRINTFUL_COUNTRIES_API, "", nil, nil)
+func (c *Client) GetCountries(ctx context.Context) ([]printfulAPIModel.Country, error) {
+	resp, err := c.fetch(ctx, "GET", PRINTFUL_COUNTRIES_API, "", nil)
 	if err != nil {
-		log.Println(err)
-		return nil, errors.New("unable to get printful response")
+		slog.WarnContext(ctx, "printful call failed", "error", err)
+		return nil, fmt.Errorf("unable to get printful response: <%w>", err)
 	}
 
 	response := GetCountriesResponse{}
 	err = json.NewDecoder(resp.Body).Decode(&response)
 	if err != nil {
-		log.Println(err)
+		slog.ErrorContext(ctx, "unable to decode printful response", "error", err)
 		return nil, errors.New("unable to decode printful response")
 	}
 
@@ -183,29 +70,40 @@ type GetProductsResponse struct {
 	Result []printfulAPIModel.Product `json:"result"`
 }
 
-var cachedProducts = make([]printfulAPIModel.Product, 0)
-var cachedProductsUpdated = time.Time{}
-
-func GetProducts() ([]printfulAPIModel.Product, error) {
+// GetProducts returns the catalog, cached for the catalog TTL. The lock is not held during the
+// Printful call, concurrent misses may each fetch the catalog.
+func (c *Client) GetProducts(ctx context.Context) ([]printfulAPIModel.Product, error) {
 	now := time.Now()
-	if now.After(cachedProductsUpdated.Add(12 * time.Hour)) {
-		resp, err := fetchRateLimited("GET", PRINTFUL_PRODUCTS_API, "", nil, nil)
-		if err != nil {
-			return nil, errors.New("unable to get printful response")
-		}
+	c.cachedProductsMutex.Lock()
+	if !now.After(c.cachedProductsUpdated.Add(c.catalogExpiry())) {
+		products := c.cachedProducts
+		c.cachedProductsMutex.Unlock()
+		return products, nil
+	}
+	c.cachedProductsMutex.Unlock()
 
-		response := GetProductsResponse{}
-		err = json.NewDecoder(resp.Body).Decode(&response)
-		if err != nil {
-			log.Println(err)
-			return nil, errors.New("unable to decode printful response")
-		}
+	resp, err := c.fetch(ctx, "GET", PRINTFUL_PRODUCTS_API, "", nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get printful response: <%w>", err)
+	}
+	defer resp.Body.Close()
 
-		cachedProducts = response.Result
-		cachedProductsUpdated = now
+	response := GetProductsResponse{}
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to decode printful response", "error", err)
+		return nil, errors.New("unable to decode printful response")
 	}
 
-	return cachedProducts, nil
+	c.cachedProductsMutex.Lock()
+	defer c.cachedProductsMutex.Unlock()
+	// Keep a catalog fetched by a call started later
+	if now.After(c.cachedProductsUpdated) {
+		c.cachedProducts = response.Result
+		c.cachedProductsUpdated = now
+	}
+
+	return response.Result, nil
 }
 
 type GetProductResponse struct {
@@ -213,13 +111,14 @@ type GetProductResponse struct {
 	Result printfulAPIModel.ProductInfo `json:"result"`
 }
 
-func GetProduct(productID int) (*printfulAPIModel.ProductInfo, error, bool) {
-	product, err := mongo.FindProduct(productID)
+func (c *Client) GetProduct(ctx context.Context, productID int) (*printfulAPIModel.ProductInfo, error, bool) {
+	product, err := c.cache.FindProduct(ctx, productID)
+	c.productLookups.record(product != nil, err)
 	if err == nil {
 		return product, nil, false
 	}
 
-	resp, err := fetchRateLimited("GET", PRINTFUL_PRODUCTS_API, "/"+strconv.Itoa(productID), nil, nil)
+	resp, err := c.fetch(ctx, "GET", PRINTFUL_PRODUCTS_API, "/"+strconv.Itoa(productID), nil)
 	if err != nil {
 		return nil, fmt.Errorf("unable to get printful response: <%w>", err), false
 	}
@@ -228,17 +127,17 @@ func GetProduct(productID int) (*printfulAPIModel.ProductInfo, error, bool) {
 
 	err = json.NewDecoder(resp.Body).Decode(&response)
 	if err != nil {
-		log.Println(err)
+		slog.ErrorContext(ctx, "unable to decode printful response", "error", err)
 		return nil, errors.New("unable to decode printful response"), false
 	}
 
 	if response.Code != 200 {
-		log.Println(err)
-		return nil, errors.New("printful returned an error"), false
+		slog.WarnContext(ctx, "printful returned an error", "code", response.Code)
+		return nil, UpstreamError{StatusCode: resp.StatusCode, Code: response.Code, Message: "printful returned an error"}, false
 	}
 
 	p := &(response.Result)
-	mongo.InsertProduct(p)
+	c.cache.InsertProduct(ctx, p)
 
 	return p, nil, true
 }
@@ -248,32 +147,33 @@ type GetVariantResponse struct {
 	Result printfulAPIModel.VariantInfo `json:"result"`
 }
 
-func GetVariant(variantID int) (*printfulAPIModel.VariantInfo, error, bool) {
-	variant, err := mongo.FindVariant(variantID)
+func (c *Client) GetVariant(ctx context.Context, variantID int) (*printfulAPIModel.VariantInfo, error, bool) {
+	variant, err := c.cache.FindVariant(ctx, variantID)
+	c.variantLookups.record(variant != nil, err)
 	if err == nil {
 		return variant, nil, false
 	}
 
-	resp, err := fetchRateLimited("GET", PRINTFUL_PRODUCTS_API, "/variant/"+strconv.Itoa(variantID), nil, nil)
+	resp, err := c.fetch(ctx, "GET", PRINTFUL_PRODUCTS_API, "/variant/"+strconv.Itoa(variantID), nil)
 	if err != nil {
-		return nil, errors.New("unable to get printful response"), false
+		return nil, fmt.Errorf("unable to get printful response: <%w>", err), false
 	}
 
 	response := GetVariantResponse{}
 
 	err = json.NewDecoder(resp.Body).Decode(&response)
 	if err != nil {
-		log.Println(err)
+		slog.ErrorContext(ctx, "unable to decode printful response", "error", err)
 		return nil, errors.New("unable to decode printful response"), false
 	}
 
 	if response.Code != 200 {
-		log.Println(err)
-		return nil, errors.New("printful returned an error"), false
+		slog.WarnContext(ctx, "printful returned an error", "code", response.Code)
+		return nil, UpstreamError{StatusCode: resp.StatusCode, Code: response.Code, Message: "printful returned an error"}, false
 	}
 
 	v := &(response.Result)
-	mongo.InsertVariant(v)
+	c.cache.InsertVariant(ctx, v)
 
 	return v, nil, true
 }
@@ -283,27 +183,23 @@ type GetTemplatesResponse struct {
 	Result printfulAPIModel.ProductTemplate `json:"result"`
 }
 
-func GetTemplates(productID int) (*printfulAPIModel.ProductTemplate, error) {
-	headers := map[string]string{
-		"Authorization": "Bearer " + printfulConfig.AccessToken,
-	}
-
-	resp, err := fetchRateLimited("GET", PRINTFUL_MOCKUP_GENERATOR_API, "/templates/"+strconv.Itoa(productID), headers, nil)
+func (c *Client) GetTemplates(ctx context.Context, productID int) (*printfulAPIModel.ProductTemplate, error) {
+	resp, err := c.fetch(ctx, "GET", PRINTFUL_MOCKUP_GENERATOR_API, "/templates/"+strconv.Itoa(productID), nil)
 	if err != nil {
-		return nil, errors.New("unable to get printful response")
+		return nil, fmt.Errorf("unable to get printful response: <%w>", err)
 	}
 
 	response := GetTemplatesResponse{}
 
 	err = json.NewDecoder(resp.Body).Decode(&response)
 	if err != nil {
-		log.Println(err)
+		slog.ErrorContext(ctx, "unable to decode printful response", "error", err)
 		return nil, errors.New("unable to decode printful response")
 	}
 
 	if response.Code != 200 {
-		log.Println(err)
-		return nil, errors.New("printful returned an error")
+		slog.WarnContext(ctx, "printful returned an error", "code", response.Code)
+		return nil, UpstreamError{StatusCode: resp.StatusCode, Code: response.Code, Message: "printful returned an error"}
 	}
 
 	p := &(response.Result)
@@ -316,27 +212,23 @@ type GetPrintfilesResponse struct {
 	Result printfulAPIModel.PrintfileInfo `json:"result"`
 }
 
-func GetPrintfiles(productID int) (*printfulAPIModel.PrintfileInfo, error) {
-	headers := map[string]string{
-		"Authorization": "Bearer " + printfulConfig.AccessToken,
-	}
-
-	resp, err := fetchRateLimited("GET", PRINTFUL_MOCKUP_GENERATOR_API, "/printfiles/"+strconv.Itoa(productID), headers, nil)
+func (c *Client) GetPrintfiles(ctx context.Context, productID int) (*printfulAPIModel.PrintfileInfo, error) {
+	resp, err := c.fetch(ctx, "GET", PRINTFUL_MOCKUP_GENERATOR_API, "/printfiles/"+strconv.Itoa(productID), nil)
 	if err != nil {
-		return nil, errors.New("unable to get printful response")
+		return nil, fmt.Errorf("unable to get printful response: <%w>", err)
 	}
 
 	response := GetPrintfilesResponse{}
 
 	err = json.NewDecoder(resp.Body).Decode(&response)
 	if err != nil {
-		log.Println(err)
+		slog.ErrorContext(ctx, "unable to decode printful response", "error", err)
 		return nil, errors.New("unable to decode printful response")
 	}
 
 	if response.Code != 200 {
-		log.Println(err)
-		return nil, errors.New("printful returned an error")
+		slog.WarnContext(ctx, "printful returned an error", "code", response.Code)
+		return nil, UpstreamError{StatusCode: resp.StatusCode, Code: response.Code, Message: "printful returned an error"}
 	}
 
 	p := &(response.Result)
@@ -344,19 +236,19 @@ func GetPrintfiles(productID int) (*printfulAPIModel.PrintfileInfo, error) {
 	return p, nil
 }
 
-func GetSimilarVariants(variantID int, placement string) ([]int, error) {
-	variantInfo, err, _ := GetVariant(variantID)
+func (c *Client) GetSimilarVariants(ctx context.Context, variantID int, placement string) ([]int, error) {
+	variantInfo, err, _ := c.GetVariant(ctx, variantID)
 	if err != nil {
 		return nil, err
 	}
 
-	productInfo, err, _ := GetProduct(variantInfo.Product.ID)
+	productInfo, err, _ := c.GetProduct(ctx, variantInfo.Product.ID)
 	if err != nil {
 		return nil, err
 	}
 
 	//log.Println("GetSimilarVariants", productInfo)
-	printfileInfo, err := GetPrintfiles(variantInfo.Product.ID)
+	printfileInfo, err := c.GetPrintfiles(ctx, variantInfo.Product.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -376,6 +268,7 @@ func GetSimilarVariants(variantID int, placement string) ([]int, error) {
 
 func matchPrintFile(printfileInfo *printfulAPIModel.PrintfileInfo, variantID1 int, variantID2 int, placement string) bool {
 	//log.Println(printfileInfo)
+	// Similar variants share the exact placement, "default" doesn't fall back to "front" here
 	printfile1 := printfileInfo.GetPrintfile(variantID1, placement)
 	printfile2 := printfileInfo.GetPrintfile(variantID2, placement)
 
@@ -390,78 +283,62 @@ type CreateSyncProductResponse struct {
 	Result schemas.SyncProduct `json:"result"`
 }
 
-func CreateSyncProduct(datas model.CreateSyncProductDatas) (*schemas.SyncProduct, error) {
+func (c *Client) CreateSyncProduct(ctx context.Context, datas model.CreateSyncProductDatas) (*model.CreatedSyncProduct, error) {
 	//log.Println("CreateSyncProduct", datas)
 
-	b64data := datas.Image[strings.IndexByte(datas.Image, ',')+1:] // Remove data:image/png;base64,
-
-	reader := base64.NewDecoder(base64.StdEncoding, strings.NewReader(b64data))
+	files := syncProductFiles(datas)
+	variantIDs := make([]int, 0, len(datas.Variants))
+	for _, v := range datas.Variants {
+		variantIDs = append(variantIDs, v.VariantID)
+	}
 
-	config, err := png.DecodeConfig(reader)
+	printfileInfo, err := c.GetPrintfiles(ctx, datas.ProductID)
 	if err != nil {
 		return nil, err
 	}
 
-	if config.Width > 20000 || config.Height > 20000 {
-		return nil, errors.New("image too large")
-	}
-
-	img, err := png.Decode(base64.NewDecoder(base64.StdEncoding, strings.NewReader(b64data)))
+	err = validatePlacements(printfileInfo, variantIDs, files)
 	if err != nil {
 		return nil, err
 	}
 
-	newWidth, newHeight := 200, 200
-	scaledImage := image.NewRGBA(image.Rect(0, 0, newWidth, newHeight))
-	srcRectangle := img.Bounds()
-	dstRectangle := scaledImage.Bounds()
-
-	scrWidth := srcRectangle.Dx()
-	scrHeigh := srcRectangle.Dy()
-
-	log.Println(scrWidth, scrHeigh)
-	//dstWidth := dstRectangle.Dx()
-	//dstHeigh := dstRectangle.Dy()
-
-	srcRatio := float64(scrWidth) / float64(scrHeigh)
-
-	if srcRatio > 1 {
-		// width > heigh
-		h := int(float64(newHeight) / srcRatio)
-		dstRectangle.Min.Y = (newHeight - h) / 2
-		dstRectangle.Max.Y = dstRectangle.Min.Y + h
-	} else if srcRatio < 1 {
-		// heigh > width
-		w := int(float64(newWidth) * srcRatio)
-		dstRectangle.Min.X = (newWidth - w) / 2
-		dstRectangle.Max.X = dstRectangle.Min.X + w
-		log.Println(dstRectangle)
-	}
-
-	draw.CatmullRom.Scale(scaledImage, dstRectangle, img, srcRectangle, draw.Over, nil)
-
-	filename := randstr.String(32)
-	log.Println(filename)
-
-	err = mongo.UploadImage(filename, img)
+	designs, err := c.loadDesigns(ctx, files)
 	if err != nil {
-		log.Println(err)
 		return nil, err
 	}
 
-	err = mongo.UploadImage(filename+"_thumb", scaledImage)
+	validation, err := checkArtwork(printfileInfo, variantIDs, files, designs, datas.RejectArtwork)
 	if err != nil {
-		log.Println(err)
 		return nil, err
 	}
 
-	headers := map[string]string{
-		"Authorization": "Bearer " + printfulConfig.AccessToken,
+	if !validation.Ready {
+		return nil, rejectedArtwork(validation, datas.RejectArtwork)
 	}
 
-	imageURL, err := url.JoinPath(printfulConfig.ImagesURL, "/", filename)
-	if err != nil {
-		return nil, errors.New("unable to create image url")
+	var thumbnailURL string
+	printfulFiles := []interface{}{}
+	for i, file := range files {
+		design, err := c.storeDesign(ctx, designs[i])
+		if err != nil {
+			return nil, err
+		}
+
+		if i == 0 {
+			thumbnailURL = design.ThumbnailURL
+		}
+
+		printfulFile := map[string]interface{}{
+			"type": file.Type,
+			"url":  design.URL,
+		}
+		if file.Position != nil {
+			printfulFile["position"] = file.Position
+		}
+		if len(file.Options) > 0 {
+			printfulFile["options"] = file.Options
+		}
+		printfulFiles = append(printfulFiles, printfulFile)
 	}
 
 	syncVariants := []map[string]interface{}{}
@@ -469,21 +346,12 @@ func CreateSyncProduct(datas model.CreateSyncProductDatas) (*schemas.SyncProduct
 		syncVariant := map[string]interface{}{
 			"variant_id":   v.VariantID,
 			"external_id":  v.ExternalVariantID,
-			"retail_price": v.RetailPrice,
-			"files": []interface{}{
-				map[string]interface{}{
-					"url": imageURL,
-				},
-			},
+			"retail_price": strconv.FormatFloat(v.RetailPrice, 'f', 2, 64),
+			"files":        printfulFiles,
 		}
 		syncVariants = append(syncVariants, syncVariant)
 	}
 
-	thumbnailURL, err := url.JoinPath(printfulConfig.ImagesURL, "/", filename+"_thumb")
-	if err != nil {
-		return nil, errors.New("unable to create thumbnail url")
-	}
-
 	body := map[string]interface{}{
 		"sync_product": map[string]interface{}{
 			"name":      datas.Name,
@@ -492,25 +360,30 @@ func CreateSyncProduct(datas model.CreateSyncProductDatas) (*schemas.SyncProduct
 		"sync_variants": syncVariants,
 	}
 
-	log.Println(body)
+	slog.DebugContext(ctx, "printful request", "body", body)
 
-	resp, err := fetchRateLimited("POST", PRINTFUL_STORE_API, "/products", headers, body)
+	resp, err := c.fetch(ctx, "POST", PRINTFUL_STORE_API, "/products", body)
 	if err != nil {
-		return nil, errors.New("unable to get printful response")
+		return nil, fmt.Errorf("unable to get printful response: <%w>", err)
 	}
 
 	response := CreateSyncProductResponse{}
 	err = json.NewDecoder(resp.Body).Decode(&response)
 	if err != nil {
-		log.Println(err)
+		slog.ErrorContext(ctx, "unable to decode printful response", "error", err)
 		return nil, errors.New("unable to decode printful response")
 	}
 
-	log.Println(response)
+	slog.DebugContext(ctx, "printful response", "response", response)
 
-	p := &(response.Result)
+	created := &model.CreatedSyncProduct{SyncProduct: response.Result}
+	for _, report := range validation.Reports {
+		if len(report.Warnings) > 0 {
+			created.ArtworkWarnings = append(created.ArtworkWarnings, report)
+		}
+	}
 
-	return p, nil
+	return created, nil
 }
 
 type GetSyncProductResponse struct {
@@ -518,18 +391,19 @@ type GetSyncProductResponse struct {
 	Result printfulAPIModel.SyncProductInfo `json:"result"`
 }
 
-func GetSyncProduct(syncProductID int64) (*printfulAPIModel.SyncProductInfo, error) {
-	/*product, err := mongo.FindProduct(productID)
+func (c *Client) GetSyncProduct(ctx context.Context, ref model.SyncProductReference) (*printfulAPIModel.SyncProductInfo, error) {
+	/*product, err := c.cache.FindProduct(ctx, productID)
 	if err == nil {
 		return product, nil, false
 	}*/
-	headers := map[string]string{
-		"Authorization": "Bearer " + printfulConfig.AccessToken,
+	path, err := syncProductPath(ref)
+	if err != nil {
+		return nil, err
 	}
 
-	resp, err := fetchRateLimited("GET", PRINTFUL_STORE_API, "/products/"+strconv.FormatInt(syncProductID, 10), headers, nil)
+	resp, err := c.fetch(ctx, "GET", PRINTFUL_STORE_API, path, nil)
 	if err != nil {
-		return nil, errors.New("unable to get printful response")
+		return nil, fmt.Errorf("unable to get printful response: <%w>", err)
 	}
 
 	//body, _ := ioutil.ReadAll(resp.Body)
@@ -538,38 +412,34 @@ func GetSyncProduct(syncProductID int64) (*printfulAPIModel.SyncProductInfo, err
 
 	err = json.NewDecoder(resp.Body).Decode(&response)
 	if err != nil {
-		log.Println(err)
+		slog.ErrorContext(ctx, "unable to decode printful response", "error", err)
 		return nil, errors.New("unable to decode printful response")
 	}
 
 	if response.Code != 200 {
-		log.Println(err)
-		return nil, errors.New("printful returned an error")
+		slog.WarnContext(ctx, "printful returned an error", "code", response.Code)
+		return nil, UpstreamError{StatusCode: resp.StatusCode, Code: response.Code, Message: "printful returned an error"}
 	}
 
 	p := &(response.Result)
-	log.Println(response.Result)
+	slog.DebugContext(ctx, "printful response", "response", response.Result)
 
 	return p, nil
 }
 
-func CalculateShippingRates(datas model.CalculateShippingRates) ([]schemas.ShippingInfo, error) {
+func (c *Client) CalculateShippingRates(ctx context.Context, datas model.CalculateShippingRates) ([]schemas.ShippingInfo, error) {
 	body := map[string]interface{}{}
 	err := mapstructure.Decode(datas, &body)
 	if err != nil {
-		log.Println(err)
+		slog.ErrorContext(ctx, "unable to encode the printful request", "error", err)
 		return nil, errors.New("error while decoding params")
 	}
 
-	log.Println(body)
-
-	headers := map[string]string{
-		"Authorization": "Bearer " + printfulConfig.AccessToken,
-	}
+	slog.DebugContext(ctx, "printful request", "body", body)
 
-	resp, err := fetchRateLimited("POST", PRINTFUL_SHIPPING_API, "/rates", headers, body)
+	resp, err := c.fetch(ctx, "POST", PRINTFUL_SHIPPING_API, "/rates", body, idempotent())
 	if err != nil {
-		return nil, errors.New("unable to get printful response")
+		return nil, fmt.Errorf("unable to get printful response: <%w>", err)
 	}
 	defer resp.Body.Close()
 
@@ -577,33 +447,29 @@ func CalculateShippingRates(datas model.CalculateShippingRates) ([]schemas.Shipp
 	response := responses.ShippingRates{}
 	err = json.NewDecoder(resp.Body).Decode(&response)
 	if err != nil {
-		log.Println(err)
+		slog.ErrorContext(ctx, "unable to decode printful response", "error", err)
 		return nil, errors.New("unable to decode printful response")
 	}
-	log.Println(response)
+	slog.DebugContext(ctx, "printful response", "response", response)
 
 	//p := &(response.Result)
 
 	return response.Result, nil
 }
 
-func CalculateTaxRate(datas model.CalculateTaxRate) (*schemas.TaxInfo, error) {
+func (c *Client) CalculateTaxRate(ctx context.Context, datas model.CalculateTaxRate) (*schemas.TaxInfo, error) {
 	body := map[string]interface{}{}
 	err := mapstructure.Decode(datas, &body)
 	if err != nil {
-		log.Println(err)
+		slog.ErrorContext(ctx, "unable to encode the printful request", "error", err)
 		return nil, errors.New("error while decoding params")
 	}
 
-	log.Println(body)
-
-	headers := map[string]string{
-		"Authorization": "Bearer " + printfulConfig.AccessToken,
-	}
+	slog.DebugContext(ctx, "printful request", "body", body)
 
-	resp, err := fetchRateLimited("POST", PRINTFUL_TAX_API, "/rates", headers, body)
+	resp, err := c.fetch(ctx, "POST", PRINTFUL_TAX_API, "/rates", body, idempotent())
 	if err != nil {
-		return nil, errors.New("unable to get printful response")
+		return nil, fmt.Errorf("unable to get printful response: <%w>", err)
 	}
 	defer resp.Body.Close()
 
@@ -611,10 +477,10 @@ func CalculateTaxRate(datas model.CalculateTaxRate) (*schemas.TaxInfo, error) {
 	response := responses.TaxRates{}
 	err = json.NewDecoder(resp.Body).Decode(&response)
 	if err != nil {
-		log.Println(err)
+		slog.ErrorContext(ctx, "unable to decode printful response", "error", err)
 		return nil, errors.New("unable to decode printful response")
 	}
-	log.Println(response)
+	slog.DebugContext(ctx, "printful response", "response", response)
 
 	//p := &(response.Result)
 
@@ -626,7 +492,8 @@ type CreateOrderResponse struct {
 	Result schemas.Order `json:"result"`
 }
 
-func CreateOrder(request model.CreateOrderRequest) (*schemas.Order, error) {
+// postOrder sends an order to Printful, once its submission is recorded
+func (c *Client) postOrder(ctx context.Context, order schemas.Order) (*schemas.Order, error) {
 	/*body := map[string]interface{}{
 		"sync_product": map[string]interface{}{
 			"name":      datas.Name,
@@ -637,21 +504,25 @@ func CreateOrder(request model.CreateOrderRequest) (*schemas.Order, error) {
 
 	log.Println(body)*/
 	body := map[string]interface{}{}
-	err := mapstructure.Decode(request.Order, &body)
+	err := mapstructure.Decode(order, &body)
 	if err != nil {
-		log.Println(err)
+		slog.ErrorContext(ctx, "unable to encode the printful request", "error", err)
 		return nil, errors.New("error while decoding request")
 	}
 
-	log.Println(body)
+	slog.DebugContext(ctx, "printful request", "body", body)
 
-	headers := map[string]string{
-		"Authorization": "Bearer " + printfulConfig.AccessToken,
+	// Without an external id, an order which failed can't be told apart from one which was never created
+	opts := []callOption{}
+	if externalID := order.ExternalID; externalID != "" {
+		opts = append(opts, idempotencyKey("order-"+externalID, func(ctx context.Context) (*http.Response, error) {
+			return c.fetch(ctx, "GET", PRINTFUL_ORDERS_API, "/@"+url.PathEscape(externalID), nil)
+		}))
 	}
 
-	resp, err := fetchRateLimited("POST", PRINTFUL_ORDERS_API, "", headers, body)
+	resp, err := c.fetch(ctx, "POST", PRINTFUL_ORDERS_API, "", body, opts...)
 	if err != nil {
-		return nil, errors.New("unable to get printful response")
+		return nil, fmt.Errorf("unable to get printful response: <%w>", err)
 	}
 
 	//body2, _ := ioutil.ReadAll(resp.Body)
@@ -660,11 +531,11 @@ func CreateOrder(request model.CreateOrderRequest) (*schemas.Order, error) {
 	response := CreateOrderResponse{}
 	err = json.NewDecoder(resp.Body).Decode(&response)
 	if err != nil {
-		log.Println(err)
+		slog.ErrorContext(ctx, "unable to decode printful response", "error", err)
 		return nil, errors.New("unable to decode printful response")
 	}
 
-	log.Println(response)
+	slog.DebugContext(ctx, "printful response", "response", response)
 
 	p := &(response.Result)
 
@@ -0,0 +1,89 @@
+package printful
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	printfulAPIModel "github.com/baldurstod/printful-api-model"
+)
+
+func TestMatchPrintFile(t *testing.T) {
+	printfileInfo := &printfulAPIModel.PrintfileInfo{
+		Printfiles: []printfulAPIModel.Printfile{{PrintfileID: 1, Width: 1800, Height: 2400}},
+	}
+	for _, variantID := range []int{4011, 4012} {
+		printfileInfo.VariantPrintfiles = append(printfileInfo.VariantPrintfiles, printfulAPIModel.VariantPrintfile{
+			VariantID:  variantID,
+			Placements: map[string]interface{}{"front": float64(1)},
+		})
+	}
+
+	for placement, similar := range map[string]bool{"front": true, "default": false, "back": false} {
+		if matchPrintFile(printfileInfo, 4011, 4012, placement) != similar {
+			t.Errorf("variants similar on placement %s should be %t", placement, similar)
+		}
+	}
+}
+
+func TestGetProductsDoesNotBlock(t *testing.T) {
+	requests := atomic.Int32{}
+	release := make(chan struct{})
+	printful := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		w.Write([]byte(`{"code":200,"result":[{"id":71},{"id":19}]}`))
+	}))
+	defer printful.Close()
+
+	c := NewClient(WithBaseURL(printful.URL))
+	ctx := context.Background()
+
+	slow := make(chan error, 1)
+	go func() {
+		_, err := c.GetProducts(ctx)
+		slow <- err
+	}()
+	for requests.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// A caller with a deadline isn't held by the catalog fetch in flight
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	fast := make(chan error, 1)
+	go func() {
+		_, err := c.GetProducts(short)
+		fast <- err
+	}()
+	select {
+	case err := <-fast:
+		if err == nil {
+			t.Error("the call should end with its context")
+		}
+	case <-time.After(time.Second):
+		close(release)
+		t.Fatal("the call should not wait for the fetch in flight")
+	}
+
+	close(release)
+	if err := <-slow; err != nil {
+		t.Fatal(err)
+	}
+
+	sent := requests.Load()
+	products, err := c.GetProducts(ctx)
+	if err != nil || len(products) != 2 {
+		t.Fatalf("unexpected products %+v, %v", products, err)
+	}
+	if requests.Load() != sent {
+		t.Error("the catalog should be served from the cache")
+	}
+}
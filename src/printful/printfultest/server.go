@@ -0,0 +1,886 @@
+// Package printfultest provides an in-process stand-in for the Printful API, backed by fixture JSON
+package printfultest
+
+import (
+	"embed"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	printfulAPIModel "github.com/baldurstod/printful-api-model"
+	"github.com/baldurstod/printful-api-model/schemas"
+)
+
+//go:embed fixtures/*.json
+var fixtures embed.FS
+
+const RATE_LIMIT = 120
+
+type failure struct {
+	statusCode int
+	reset      int
+	// The request is handled, only the reply is replaced by the error
+	handled bool
+	// Only requests to this path fail when set
+	path string
+}
+
+type Server struct {
+	*httptest.Server
+	// When set, every endpoint except the catalog requires this bearer token
+	AccessToken string
+
+	mutex        sync.Mutex
+	failures     []failure
+	delay        time.Duration
+	requests     []string
+	nextID       int64
+	syncProducts map[int64]*printfulAPIModel.SyncProductInfo
+	orders       map[int64]*schemas.Order
+	webhooks     map[string]interface{}
+}
+
+// NewServer starts a fake Printful API. Callers must Close it when done.
+func NewServer() *Server {
+	s := &Server{
+		nextID:       1000,
+		syncProducts: make(map[int64]*printfulAPIModel.SyncProductInfo),
+		orders:       make(map[int64]*schemas.Order),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+
+	return s
+}
+
+// FailNext makes the next count requests answer with statusCode
+func (s *Server) FailNext(statusCode int, count int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i := 0; i < count; i++ {
+		s.failures = append(s.failures, failure{statusCode: statusCode})
+	}
+}
+
+// FailNextTo makes the next request to path answer with statusCode, other requests are served
+func (s *Server) FailNextTo(path string, statusCode int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.failures = append(s.failures, failure{statusCode: statusCode, path: path})
+}
+
+// RateLimitNext makes the next count requests answer with 429, asking to retry after reset seconds
+func (s *Server) RateLimitNext(count int, reset int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i := 0; i < count; i++ {
+		s.failures = append(s.failures, failure{statusCode: http.StatusTooManyRequests, reset: reset})
+	}
+}
+
+// LoseNextReply handles the next count requests but answers them with statusCode,
+// as when Printful fails after doing the work or when the reply is lost
+func (s *Server) LoseNextReply(statusCode int, count int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i := 0; i < count; i++ {
+		s.failures = append(s.failures, failure{statusCode: statusCode, handled: true})
+	}
+}
+
+// SetDelay slows down every reply by d
+func (s *Server) SetDelay(d time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.delay = d
+}
+
+// Requests returns the "METHOD /path" of every request received so far
+func (s *Server) Requests() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]string(nil), s.requests...)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+	delay := s.delay
+	var next *failure
+	for i, f := range s.failures {
+		if f.path == "" || f.path == r.URL.Path {
+			next = &f
+			s.failures = append(s.failures[:i:i], s.failures[i+1:]...)
+			break
+		}
+	}
+	s.mutex.Unlock()
+
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if next != nil {
+		if next.handled {
+			s.route(httptest.NewRecorder(), r)
+		}
+		if next.statusCode == http.StatusTooManyRequests {
+			reset := strconv.Itoa(next.reset)
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(RATE_LIMIT))
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", reset)
+			w.Header().Set("Retry-After", reset)
+		}
+		writeError(w, next.statusCode, http.StatusText(next.statusCode))
+		return
+	}
+
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(RATE_LIMIT))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(RATE_LIMIT-1))
+	w.Header().Set("X-RateLimit-Reset", "60")
+
+	s.route(w, r)
+}
+
+func (s *Server) route(w http.ResponseWriter, r *http.Request) {
+	// External ids may contain escaped slashes, split before unescaping
+	segments := strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/")
+	for i, segment := range segments {
+		if unescaped, err := url.PathUnescape(segment); err == nil {
+			segments[i] = unescaped
+		}
+	}
+	public := segments[0] == "products" || segments[0] == "countries"
+	if !public && s.AccessToken != "" && r.Header.Get("Authorization") != "Bearer "+s.AccessToken {
+		writeError(w, http.StatusUnauthorized, "The access token provided is invalid.")
+		return
+	}
+
+	switch {
+	case match(r, "GET", segments, "countries"):
+		writeFixture(w, "countries.json")
+	case match(r, "GET", segments, "products"):
+		writeFixture(w, "products.json")
+	case match(r, "GET", segments, "products", "variant", "*"):
+		s.getVariant(w, segments[2])
+	case match(r, "GET", segments, "products", "*"):
+		writeFixture(w, "product_"+segments[1]+".json")
+	case match(r, "GET", segments, "mockup-generator", "templates", "*"):
+		writeFixture(w, "templates_"+segments[2]+".json")
+	case match(r, "GET", segments, "mockup-generator", "printfiles", "*"):
+		writeFixture(w, "printfiles_"+segments[2]+".json")
+	case match(r, "GET", segments, "store", "products"):
+		s.listSyncProducts(w, r)
+	case match(r, "POST", segments, "store", "products"):
+		s.createSyncProduct(w, r)
+	case match(r, "GET", segments, "store", "products", "*"):
+		s.getSyncProduct(w, segments[2])
+	case match(r, "PUT", segments, "store", "products", "*"):
+		s.modifySyncProduct(w, r, segments[2])
+	case match(r, "DELETE", segments, "store", "products", "*"):
+		s.deleteSyncProduct(w, segments[2])
+	case match(r, "POST", segments, "store", "products", "*", "variants"):
+		s.createSyncVariant(w, r, segments[2])
+	case match(r, "GET", segments, "store", "variants", "*"):
+		s.getSyncVariant(w, segments[2])
+	case match(r, "PUT", segments, "store", "variants", "*"):
+		s.modifySyncVariant(w, r, segments[2])
+	case match(r, "DELETE", segments, "store", "variants", "*"):
+		s.deleteSyncVariant(w, segments[2])
+	case match(r, "POST", segments, "shipping", "rates"):
+		writeFixture(w, "shipping_rates.json")
+	case match(r, "POST", segments, "tax", "rates"):
+		writeFixture(w, "tax_rates.json")
+	case match(r, "GET", segments, "orders"):
+		s.listOrders(w, r)
+	case match(r, "POST", segments, "orders"):
+		s.createOrder(w, r)
+	case match(r, "POST", segments, "orders", "estimate-costs"):
+		s.estimateOrderCosts(w, r)
+	case match(r, "GET", segments, "orders", "*"):
+		s.getOrder(w, segments[1])
+	case match(r, "PUT", segments, "orders", "*"):
+		s.updateOrder(w, r, segments[1])
+	case match(r, "POST", segments, "orders", "*", "confirm"):
+		s.confirmOrder(w, segments[1])
+	case match(r, "DELETE", segments, "orders", "*"):
+		s.cancelOrder(w, segments[1])
+	case match(r, "GET", segments, "oauth", "scopes"):
+		writeResult(w, []map[string]string{{"name": "Orders", "value": "orders"}})
+	case match(r, "GET", segments, "webhooks"):
+		s.getWebhooks(w)
+	case match(r, "POST", segments, "webhooks"):
+		s.setWebhooks(w, r)
+	case match(r, "DELETE", segments, "webhooks"):
+		s.disableWebhooks(w)
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+func match(r *http.Request, method string, segments []string, pattern ...string) bool {
+	if r.Method != method || len(segments) != len(pattern) {
+		return false
+	}
+
+	for i, p := range pattern {
+		if p != "*" && p != segments[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeResult(w http.ResponseWriter, result interface{}) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"code":   http.StatusOK,
+		"result": result,
+	})
+}
+
+func writeError(w http.ResponseWriter, statusCode int, message string) {
+	writeJSON(w, statusCode, map[string]interface{}{
+		"code":   statusCode,
+		"result": message,
+		"error": map[string]interface{}{
+			"reason":  http.StatusText(statusCode),
+			"message": message,
+		},
+	})
+}
+
+func writeFixture(w http.ResponseWriter, name string) {
+	content, err := fixtures.ReadFile("fixtures/" + name)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(content)
+}
+
+func paging(r *http.Request, total int) (int, int) {
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > total {
+		offset = total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+
+	return offset, end
+}
+
+func (s *Server) getVariant(w http.ResponseWriter, id string) {
+	variantID, err := strconv.Atoi(id)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid variant id")
+		return
+	}
+
+	entries, _ := fixtures.ReadDir("fixtures")
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), "product_") {
+			continue
+		}
+
+		content, _ := fixtures.ReadFile("fixtures/" + entry.Name())
+		response := struct {
+			Result printfulAPIModel.ProductInfo `json:"result"`
+		}{}
+		if err := json.Unmarshal(content, &response); err != nil {
+			continue
+		}
+
+		for _, v := range response.Result.Variants {
+			if v.ID == variantID {
+				writeResult(w, printfulAPIModel.VariantInfo{Variant: v, Product: response.Result.Product})
+				return
+			}
+		}
+	}
+
+	writeError(w, http.StatusNotFound, "Variant not found")
+}
+
+type syncProductRequest struct {
+	SyncProduct  schemas.SyncProduct   `json:"sync_product"`
+	SyncVariants []schemas.SyncVariant `json:"sync_variants"`
+}
+
+func (s *Server) createSyncProduct(w http.ResponseWriter, r *http.Request) {
+	request := syncProductRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if len(request.SyncVariants) == 0 {
+		writeError(w, http.StatusBadRequest, "Sync variants are required")
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.nextID++
+	product := &printfulAPIModel.SyncProductInfo{SyncProduct: request.SyncProduct}
+	product.SyncProduct.ID = s.nextID
+	product.SyncVariants = s.newSyncVariants(product.SyncProduct.ID, request.SyncVariants)
+	s.updateSyncProductCounts(product)
+
+	s.syncProducts[product.SyncProduct.ID] = product
+
+	writeResult(w, product.SyncProduct)
+}
+
+func (s *Server) listSyncProducts(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	search := strings.ToLower(r.URL.Query().Get("search"))
+	products := make([]schemas.SyncProduct, 0, len(s.syncProducts))
+	for id := int64(0); id <= s.nextID; id++ {
+		if p, ok := s.syncProducts[id]; ok && strings.Contains(strings.ToLower(p.SyncProduct.Name), search) {
+			products = append(products, p.SyncProduct)
+		}
+	}
+
+	offset, end := paging(r, len(products))
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"code":   http.StatusOK,
+		"result": products[offset:end],
+		"paging": map[string]int{"total": len(products), "offset": offset, "limit": end - offset},
+	})
+}
+
+// findSyncProduct accepts a Printful id or an @external_id
+func (s *Server) findSyncProduct(id string) *printfulAPIModel.SyncProductInfo {
+	if strings.HasPrefix(id, "@") {
+		externalID := strings.TrimPrefix(id, "@")
+		for _, p := range s.syncProducts {
+			if p.SyncProduct.ExternalID == externalID {
+				return p
+			}
+		}
+		return nil
+	}
+
+	syncProductID, _ := strconv.ParseInt(id, 10, 64)
+
+	return s.syncProducts[syncProductID]
+}
+
+// findSyncVariant accepts a Printful id or an @external_id
+func (s *Server) findSyncVariant(id string) (*printfulAPIModel.SyncProductInfo, int) {
+	externalID := strings.TrimPrefix(id, "@")
+	syncVariantID, _ := strconv.ParseInt(id, 10, 64)
+
+	for _, p := range s.syncProducts {
+		for i, v := range p.SyncVariants {
+			if (strings.HasPrefix(id, "@") && v.ExternalID == externalID) || v.ID == syncVariantID {
+				return p, i
+			}
+		}
+	}
+
+	return nil, -1
+}
+
+func (s *Server) getSyncProduct(w http.ResponseWriter, id string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	product := s.findSyncProduct(id)
+	if product == nil {
+		writeError(w, http.StatusNotFound, "Sync product not found")
+		return
+	}
+
+	writeResult(w, product)
+}
+
+func (s *Server) modifySyncProduct(w http.ResponseWriter, r *http.Request, id string) {
+	request := syncProductRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	product := s.findSyncProduct(id)
+	if product == nil {
+		writeError(w, http.StatusNotFound, "Sync product not found")
+		return
+	}
+
+	if request.SyncProduct.Name != "" {
+		product.SyncProduct.Name = request.SyncProduct.Name
+	}
+	if request.SyncProduct.Thumbnail != "" {
+		product.SyncProduct.Thumbnail = request.SyncProduct.Thumbnail
+	}
+	if request.SyncVariants != nil {
+		product.SyncVariants = s.newSyncVariants(product.SyncProduct.ID, request.SyncVariants)
+	}
+	s.updateSyncProductCounts(product)
+
+	writeResult(w, product.SyncProduct)
+}
+
+func (s *Server) deleteSyncProduct(w http.ResponseWriter, id string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	product := s.findSyncProduct(id)
+	if product == nil {
+		writeError(w, http.StatusNotFound, "Sync product not found")
+		return
+	}
+
+	delete(s.syncProducts, product.SyncProduct.ID)
+
+	writeResult(w, product)
+}
+
+func (s *Server) newSyncVariants(syncProductID int64, variants []schemas.SyncVariant) []schemas.SyncVariant {
+	for i := range variants {
+		s.nextID++
+		variants[i].ID = s.nextID
+		variants[i].SyncProductID = syncProductID
+		variants[i].Synced = true
+		variants[i].Files = s.newFiles(variants[i].Files, nil)
+	}
+
+	return variants
+}
+
+// newFiles gives an id to the files of a sync variant. A file sent with only its id is
+// the one of previous with that id, as Printful keeps a file referenced by id.
+func (s *Server) newFiles(files []schemas.SyncVariantFile, previous []schemas.SyncVariantFile) []schemas.SyncVariantFile {
+	created := make([]schemas.SyncVariantFile, 0, len(files))
+	for _, file := range files {
+		if file.ID != 0 && file.URL == "" {
+			for _, p := range previous {
+				if p.ID == file.ID {
+					file = p
+				}
+			}
+			created = append(created, file)
+			continue
+		}
+
+		s.nextID++
+		file.ID = int(s.nextID)
+		created = append(created, file)
+	}
+
+	return created
+}
+
+func (s *Server) updateSyncProductCounts(product *printfulAPIModel.SyncProductInfo) {
+	product.SyncProduct.Variants = len(product.SyncVariants)
+	product.SyncProduct.Synced = len(product.SyncVariants)
+}
+
+func (s *Server) createSyncVariant(w http.ResponseWriter, r *http.Request, id string) {
+	variant := schemas.SyncVariant{}
+	if err := json.NewDecoder(r.Body).Decode(&variant); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if variant.VariantID == 0 || len(variant.Files) == 0 {
+		writeError(w, http.StatusBadRequest, "Variant id and files are required")
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	product := s.findSyncProduct(id)
+	if product == nil {
+		writeError(w, http.StatusNotFound, "Sync product not found")
+		return
+	}
+
+	variants := s.newSyncVariants(product.SyncProduct.ID, []schemas.SyncVariant{variant})
+	product.SyncVariants = append(product.SyncVariants, variants...)
+	s.updateSyncProductCounts(product)
+
+	writeResult(w, variants[0])
+}
+
+func (s *Server) getSyncVariant(w http.ResponseWriter, id string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	product, i := s.findSyncVariant(id)
+	if product == nil {
+		writeError(w, http.StatusNotFound, "Sync variant not found")
+		return
+	}
+
+	writeResult(w, product.SyncVariants[i])
+}
+
+func (s *Server) modifySyncVariant(w http.ResponseWriter, r *http.Request, id string) {
+	update := map[string]json.RawMessage{}
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	product, i := s.findSyncVariant(id)
+	if product == nil {
+		writeError(w, http.StatusNotFound, "Sync variant not found")
+		return
+	}
+
+	// Only the fields present in the request are modified
+	variant := &product.SyncVariants[i]
+	previousFiles := variant.Files
+	current, _ := json.Marshal(variant)
+	if _, ok := update["files"]; ok {
+		// Decoding would reuse the previous files for the fields missing from the request
+		variant.Files = nil
+	}
+	merged := map[string]json.RawMessage{}
+	json.Unmarshal(current, &merged)
+	for k, v := range update {
+		merged[k] = v
+	}
+	content, _ := json.Marshal(merged)
+	if err := json.Unmarshal(content, variant); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if _, ok := update["files"]; ok {
+		variant.Files = s.newFiles(variant.Files, previousFiles)
+	}
+
+	writeResult(w, variant)
+}
+
+func (s *Server) deleteSyncVariant(w http.ResponseWriter, id string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	product, i := s.findSyncVariant(id)
+	if product == nil {
+		writeError(w, http.StatusNotFound, "Sync variant not found")
+		return
+	}
+
+	product.SyncVariants = append(product.SyncVariants[:i], product.SyncVariants[i+1:]...)
+	s.updateSyncProductCounts(product)
+
+	writeResult(w, map[string]interface{}{})
+}
+
+func (s *Server) createOrder(w http.ResponseWriter, r *http.Request) {
+	order := schemas.NewOrder()
+	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if len(order.Items) == 0 {
+		writeError(w, http.StatusBadRequest, "Order items are required")
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if order.ExternalID != "" && s.findOrder("@"+order.ExternalID) != nil {
+		writeError(w, http.StatusConflict, "Order with this external ID already exists")
+		return
+	}
+
+	s.nextID++
+	now := time.Now().Unix()
+	order.ID = s.nextID
+	order.Status = "draft"
+	if r.URL.Query().Get("confirm") == "true" {
+		order.Status = "pending"
+	}
+	order.Created = now
+	order.Updated = now
+	order.Costs = estimateCosts(order)
+
+	s.orders[order.ID] = &order
+
+	writeResult(w, order)
+}
+
+func (s *Server) listOrders(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	status := r.URL.Query().Get("status")
+	orders := make([]schemas.Order, 0, len(s.orders))
+	for id := int64(0); id <= s.nextID; id++ {
+		if o, ok := s.orders[id]; ok && (status == "" || o.Status == status) {
+			orders = append(orders, *o)
+		}
+	}
+
+	offset, end := paging(r, len(orders))
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"code":   http.StatusOK,
+		"result": orders[offset:end],
+		"paging": map[string]int{"total": len(orders), "offset": offset, "limit": end - offset},
+	})
+}
+
+func (s *Server) getOrder(w http.ResponseWriter, id string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	order := s.findOrder(id)
+	if order == nil {
+		writeError(w, http.StatusNotFound, "Order not found")
+		return
+	}
+
+	writeResult(w, order)
+}
+
+// findOrder accepts a Printful id or an @external_id
+func (s *Server) findOrder(id string) *schemas.Order {
+	if strings.HasPrefix(id, "@") {
+		externalID := strings.TrimPrefix(id, "@")
+		for _, o := range s.orders {
+			if o.ExternalID == externalID {
+				return o
+			}
+		}
+		return nil
+	}
+
+	orderID, _ := strconv.ParseInt(id, 10, 64)
+
+	return s.orders[orderID]
+}
+
+func estimateCosts(order schemas.Order) schemas.Costs {
+	costs := schemas.Costs{Currency: "USD"}
+	for _, item := range order.Items {
+		costs.Subtotal += 9.25 * float64(item.Quantity)
+	}
+	costs.Shipping = 4.75
+	costs.Total = costs.Subtotal + costs.Shipping
+
+	return costs
+}
+
+func (s *Server) updateOrder(w http.ResponseWriter, r *http.Request, id string) {
+	update := map[string]json.RawMessage{}
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	order := s.findOrder(id)
+	if order == nil {
+		writeError(w, http.StatusNotFound, "Order not found")
+		return
+	}
+
+	if order.Status != "draft" && order.Status != "failed" {
+		writeError(w, http.StatusBadRequest, "Only draft and failed orders can be updated")
+		return
+	}
+
+	// Like Printful, every field sent replaces the previous value, even with a zero value
+	updated := *order
+	content, _ := json.Marshal(update)
+	if err := json.Unmarshal(content, &updated); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	updated.ID, updated.Store, updated.Status, updated.Created = order.ID, order.Store, order.Status, order.Created
+	updated.Costs = estimateCosts(updated)
+	*order = updated
+
+	if r.URL.Query().Get("confirm") == "true" {
+		order.Status = "pending"
+	}
+	order.Updated = time.Now().Unix()
+
+	writeResult(w, order)
+}
+
+func (s *Server) confirmOrder(w http.ResponseWriter, id string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	order := s.findOrder(id)
+	if order == nil {
+		writeError(w, http.StatusNotFound, "Order not found")
+		return
+	}
+
+	if order.Status != "draft" {
+		writeError(w, http.StatusBadRequest, "Only draft orders can be confirmed")
+		return
+	}
+
+	order.Status = "pending"
+	order.Updated = time.Now().Unix()
+
+	writeResult(w, order)
+}
+
+func (s *Server) cancelOrder(w http.ResponseWriter, id string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	order := s.findOrder(id)
+	if order == nil {
+		writeError(w, http.StatusNotFound, "Order not found")
+		return
+	}
+
+	switch order.Status {
+	case "draft", "pending", "failed", "onhold":
+	default:
+		writeError(w, http.StatusBadRequest, "This order can not be canceled")
+		return
+	}
+
+	order.Status = "canceled"
+	order.Updated = time.Now().Unix()
+
+	writeResult(w, order)
+}
+
+func (s *Server) estimateOrderCosts(w http.ResponseWriter, r *http.Request) {
+	order := schemas.Order{}
+	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	costs := estimateCosts(order)
+	writeResult(w, map[string]interface{}{
+		"costs": costs,
+		"retail_costs": schemas.RetailCosts{
+			Currency: costs.Currency,
+			Subtotal: costs.Subtotal,
+			Shipping: costs.Shipping,
+			Total:    costs.Total,
+		},
+	})
+}
+
+// AddSyncProduct seeds the store with a sync product and returns its id
+func (s *Server) AddSyncProduct(product schemas.SyncProduct, variants []schemas.SyncVariant) int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.nextID++
+	info := &printfulAPIModel.SyncProductInfo{SyncProduct: product}
+	info.SyncProduct.ID = s.nextID
+	info.SyncVariants = s.newSyncVariants(info.SyncProduct.ID, variants)
+	s.updateSyncProductCounts(info)
+	s.syncProducts[info.SyncProduct.ID] = info
+
+	return info.SyncProduct.ID
+}
+
+// Webhooks returns the webhook configuration, nil when disabled
+func (s *Server) Webhooks() map[string]interface{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.webhooks
+}
+
+func (s *Server) webhooksResult() map[string]interface{} {
+	if s.webhooks == nil {
+		return map[string]interface{}{"url": nil, "types": []string{}, "params": []interface{}{}}
+	}
+
+	return s.webhooks
+}
+
+func (s *Server) getWebhooks(w http.ResponseWriter) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	writeResult(w, s.webhooksResult())
+}
+
+func (s *Server) setWebhooks(w http.ResponseWriter, r *http.Request) {
+	request := struct {
+		URL    string      `json:"url"`
+		Types  []string    `json:"types"`
+		Params interface{} `json:"params"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if request.URL == "" {
+		writeError(w, http.StatusBadRequest, "Webhook URL is required")
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.webhooks = map[string]interface{}{"url": request.URL, "types": request.Types, "params": []interface{}{}}
+
+	writeResult(w, s.webhooks)
+}
+
+func (s *Server) disableWebhooks(w http.ResponseWriter) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.webhooks = nil
+
+	writeResult(w, s.webhooksResult())
+}
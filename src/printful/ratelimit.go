@@ -0,0 +1,263 @@
+package printful
+
+import (
+	"context"
+	"net/http"
+	"printfulapi/src/metrics"
+	"printfulapi/src/model"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Calls sent at once on an endpoint whose rate limit is not known yet
+const UNKNOWN_BUCKET_CONCURRENCY = 1
+
+// Share of a bucket background calls leave to the interactive ones
+const BACKGROUND_RESERVE = 0.25
+
+// Wait when Printful doesn't tell when its rate limit resets
+const DEFAULT_RATE_LIMIT_RESET = 60 * time.Second
+
+// Times a call is sent again after a 429
+const MAX_RATE_LIMITED_RETRIES = 3
+
+type backgroundKey struct{}
+
+// withBackgroundPriority marks the calls made with ctx as background work, such as warming the cache.
+// They are sent only when no interactive call is waiting and leave a reserve of the bucket to them.
+func withBackgroundPriority(ctx context.Context) context.Context {
+	return context.WithValue(ctx, backgroundKey{}, true)
+}
+
+func isBackground(ctx context.Context) bool {
+	background, _ := ctx.Value(backgroundKey{}).(bool)
+	return background
+}
+
+// rateLimiter shares the Printful rate limit of each endpoint between the calls, learning the budget
+// from the X-RateLimit-* headers of the replies
+type rateLimiter struct {
+	buckets map[string]*rateBucket
+	mutex   sync.Mutex
+	now     func() time.Time
+}
+
+type rateBucket struct {
+	// 0 until Printful sends X-RateLimit-Limit
+	limit     int
+	remaining int
+	// When remaining goes back to limit, zero when unknown
+	reset      time.Time
+	retryAfter time.Time
+	inFlight   int
+	// Interactive calls waiting, background calls wait for them
+	waiting int
+	// Closed and replaced when a call ends or no interactive call is left waiting
+	changed chan struct{}
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		buckets: make(map[string]*rateBucket),
+		now:     time.Now,
+	}
+}
+
+func (l *rateLimiter) bucket(name string) *rateBucket {
+	b, ok := l.buckets[name]
+	if !ok {
+		b = &rateBucket{changed: make(chan struct{})}
+		l.buckets[name] = b
+	}
+	return b
+}
+
+// wait blocks until a call can be sent on the bucket, done must be called once the call ends.
+// A RateLimitedError is returned at once when the wait would outlast the deadline of ctx.
+func (l *rateLimiter) wait(ctx context.Context, name string) error {
+	background := isBackground(ctx)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	b := l.bucket(name)
+	if !background {
+		b.waiting++
+		defer func() {
+			b.waiting--
+			// Background calls wait for the interactive ones, even when this one gives up
+			if b.waiting == 0 {
+				b.signal()
+			}
+		}()
+	}
+
+	for {
+		now := l.now()
+		delay, ok := b.admit(now, background)
+		if ok {
+			b.inFlight++
+			return nil
+		}
+
+		if deadline, hasDeadline := ctx.Deadline(); hasDeadline && delay > 0 && now.Add(delay).After(deadline) {
+			// Retry-After is sent in whole seconds
+			return RateLimitedError{RetryAfter: (delay + time.Second - 1).Truncate(time.Second)}
+		}
+
+		changed := b.changed
+		l.mutex.Unlock()
+		start := time.Now()
+		err := sleepUntilChanged(ctx, changed, delay)
+		metrics.PrintfulRateLimitWait.WithLabelValues(name).Add(metrics.Since(start))
+		l.mutex.Lock()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// admit tells whether a call can be sent now, or how long to wait otherwise.
+// A zero delay means waiting for a call in flight to end.
+func (b *rateBucket) admit(now time.Time, background bool) (time.Duration, bool) {
+	if now.Before(b.retryAfter) {
+		return b.retryAfter.Sub(now), false
+	}
+
+	if b.limit == 0 {
+		return 0, b.inFlight < UNKNOWN_BUCKET_CONCURRENCY
+	}
+
+	if !b.reset.IsZero() && !now.Before(b.reset) {
+		b.remaining = b.limit
+		b.reset = time.Time{}
+	}
+
+	available := b.remaining - b.inFlight
+	if background {
+		if b.waiting > 0 {
+			return 0, false
+		}
+		available -= int(float64(b.limit) * BACKGROUND_RESERVE)
+	}
+	if available > 0 {
+		return 0, true
+	}
+
+	switch {
+	case !b.reset.IsZero():
+		return b.reset.Sub(now), false
+	case b.inFlight > 0:
+		return 0, false
+	default:
+		return DEFAULT_RATE_LIMIT_RESET, false
+	}
+}
+
+// signal wakes the calls waiting on the bucket
+func (b *rateBucket) signal() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// done ends a call and learns the state of the bucket from resp, which is nil when no reply was received.
+// It returns how long to wait before sending again a call Printful answered with 429.
+func (l *rateLimiter) done(name string, resp *http.Response) time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	b := l.bucket(name)
+	b.inFlight--
+	b.signal()
+
+	if resp == nil {
+		return 0
+	}
+
+	now := l.now()
+	header := resp.Header
+	if limit, err := strconv.Atoi(header.Get("X-RateLimit-Limit")); err == nil {
+		b.limit = limit
+	}
+	if remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining")); err == nil {
+		b.remaining = remaining
+	}
+	resetSent := false
+	if reset, err := strconv.Atoi(header.Get("X-RateLimit-Reset")); err == nil {
+		b.reset = now.Add(time.Duration(reset) * time.Second)
+		resetSent = true
+	}
+
+	var retryAfter time.Duration
+	if resp.StatusCode == http.StatusTooManyRequests {
+		b.remaining = 0
+		retryAfter = DEFAULT_RATE_LIMIT_RESET
+		if seconds, err := strconv.Atoi(header.Get("Retry-After")); err == nil {
+			retryAfter = time.Duration(seconds) * time.Second
+		} else if b.reset.After(now) {
+			retryAfter = b.reset.Sub(now)
+		}
+		b.retryAfter = now.Add(retryAfter)
+	}
+
+	// Without a reset to wait for, an exhausted bucket would never be refilled
+	if b.remaining <= 0 && !resetSent && !b.reset.After(now) {
+		b.reset = now.Add(DEFAULT_RATE_LIMIT_RESET)
+		if retryAfter > 0 {
+			b.reset = now.Add(retryAfter)
+		}
+	}
+
+	return retryAfter
+}
+
+// state returns the buckets known so far, by endpoint
+func (l *rateLimiter) state() []model.EndpointRateLimit {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	limits := make([]model.EndpointRateLimit, 0, len(l.buckets))
+	for name, b := range l.buckets {
+		limits = append(limits, model.EndpointRateLimit{
+			Endpoint:   name,
+			Limit:      b.limit,
+			Remaining:  b.remaining,
+			ResetIn:    secondsUntil(now, b.reset),
+			RetryAfter: secondsUntil(now, b.retryAfter),
+			InFlight:   b.inFlight,
+			Waiting:    b.waiting,
+		})
+	}
+	sort.Slice(limits, func(i, j int) bool { return limits[i].Endpoint < limits[j].Endpoint })
+
+	return limits
+}
+
+// secondsUntil rounds up, 0 when t is zero or past
+func secondsUntil(now time.Time, t time.Time) int {
+	if t.IsZero() || !t.After(now) {
+		return 0
+	}
+	return int((t.Sub(now) + time.Second - 1) / time.Second)
+}
+
+func sleepUntilChanged(ctx context.Context, changed <-chan struct{}, delay time.Duration) error {
+	var timeout <-chan time.Time
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-changed:
+	case <-timeout:
+	}
+
+	return nil
+}
@@ -0,0 +1,201 @@
+package printful
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newTestRateLimiter returns a limiter on a clock which only moves when advance is called.
+// It starts at the current time, wait compares it with the deadline of the context.
+func newTestRateLimiter() (*rateLimiter, func(d time.Duration)) {
+	l := newRateLimiter()
+	clock := time.Now()
+	l.now = func() time.Time { return clock }
+
+	return l, func(d time.Duration) {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		clock = clock.Add(d)
+	}
+}
+
+func rateLimitReply(statusCode int, limit int, remaining int, reset int) *http.Response {
+	header := http.Header{}
+	header.Set("X-RateLimit-Limit", strconv.Itoa(limit))
+	header.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	header.Set("X-RateLimit-Reset", strconv.Itoa(reset))
+	return &http.Response{StatusCode: statusCode, Header: header}
+}
+
+// shortDeadline makes wait answer at once instead of blocking when the bucket is exhausted
+func shortDeadline(t *testing.T, ctx context.Context) context.Context {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestRateLimiterLearnsBudget(t *testing.T) {
+	l, advance := newTestRateLimiter()
+	ctx := context.Background()
+
+	// Until the budget is known, calls are sent one at a time
+	if err := l.wait(ctx, "store"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.wait(shortDeadline(t, ctx), "store"); err == nil {
+		t.Fatal("a second call should wait for the first one while the budget is unknown")
+	}
+	l.done("store", rateLimitReply(http.StatusOK, 10, 2, 30))
+
+	for i := 0; i < 2; i++ {
+		if err := l.wait(ctx, "store"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var rateLimited RateLimitedError
+	if err := l.wait(shortDeadline(t, ctx), "store"); !errors.As(err, &rateLimited) || rateLimited.RetryAfter != 30*time.Second {
+		t.Fatalf("the call should wait for the reset, got %v", err)
+	}
+
+	// The budget is back once the reset has passed
+	l.done("store", nil)
+	l.done("store", nil)
+	advance(30 * time.Second)
+	for i := 0; i < 10; i++ {
+		if err := l.wait(shortDeadline(t, ctx), "store"); err != nil {
+			t.Fatalf("call %d should be sent after the reset, got %v", i, err)
+		}
+	}
+
+	if retryAfter := l.done("store", rateLimitReply(http.StatusTooManyRequests, 10, 0, 45)); retryAfter != 45*time.Second {
+		t.Errorf("a 429 without Retry-After should wait for the reset, got %s", retryAfter)
+	}
+	state := l.state()
+	if len(state) != 1 || state[0].Limit != 10 || state[0].Remaining != 0 || state[0].RetryAfter != 45 || state[0].InFlight != 9 {
+		t.Errorf("unexpected state %+v", state)
+	}
+}
+
+func TestRateLimiterRefillsWithoutReset(t *testing.T) {
+	l, advance := newTestRateLimiter()
+	ctx := context.Background()
+
+	// A 429 with neither X-RateLimit-Reset nor Retry-After
+	if err := l.wait(ctx, "store"); err != nil {
+		t.Fatal(err)
+	}
+	header := http.Header{}
+	header.Set("X-RateLimit-Limit", "10")
+	if retryAfter := l.done("store", &http.Response{StatusCode: http.StatusTooManyRequests, Header: header}); retryAfter != DEFAULT_RATE_LIMIT_RESET {
+		t.Errorf("a 429 without any delay should wait the default reset, got %s", retryAfter)
+	}
+
+	advance(DEFAULT_RATE_LIMIT_RESET)
+	if err := l.wait(shortDeadline(t, ctx), "store"); err != nil {
+		t.Fatalf("the bucket should be refilled once the 429 has passed, got %v", err)
+	}
+
+	// The same for a reply emptying the bucket without telling when it refills
+	header.Set("X-RateLimit-Remaining", "0")
+	l.done("store", &http.Response{StatusCode: http.StatusOK, Header: header})
+	if err := l.wait(shortDeadline(t, ctx), "store"); err == nil {
+		t.Fatal("an empty bucket should wait for its reset")
+	}
+	advance(DEFAULT_RATE_LIMIT_RESET)
+	if err := l.wait(shortDeadline(t, ctx), "store"); err != nil {
+		t.Fatalf("the bucket should be refilled after the default reset, got %v", err)
+	}
+}
+
+func TestRateLimiterBackgroundReserve(t *testing.T) {
+	l, _ := newTestRateLimiter()
+	ctx := context.Background()
+	background := withBackgroundPriority(ctx)
+
+	if err := l.wait(ctx, "store"); err != nil {
+		t.Fatal(err)
+	}
+	l.done("store", rateLimitReply(http.StatusOK, 8, 8, 60))
+
+	reserve := int(8 * BACKGROUND_RESERVE)
+	for i := 0; i < 8-reserve; i++ {
+		if err := l.wait(background, "store"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.wait(shortDeadline(t, background), "store"); err == nil {
+		t.Fatal("background calls should leave the reserve to the interactive ones")
+	}
+	for i := 0; i < reserve; i++ {
+		if err := l.wait(shortDeadline(t, ctx), "store"); err != nil {
+			t.Fatalf("interactive calls should use the reserve, got %v", err)
+		}
+	}
+}
+
+func TestRateLimiterBackgroundYields(t *testing.T) {
+	l, advance := newTestRateLimiter()
+	ctx := context.Background()
+
+	if err := l.wait(ctx, "store"); err != nil {
+		t.Fatal(err)
+	}
+
+	interactiveDone := make(chan error, 1)
+	go func() { interactiveDone <- l.wait(ctx, "store") }()
+	waitForWaiting(t, l, 1)
+	backgroundDone := make(chan error, 1)
+	go func() { backgroundDone <- l.wait(withBackgroundPriority(ctx), "store") }()
+
+	// The only call left before the reset goes to the interactive call
+	l.done("store", rateLimitReply(http.StatusOK, 4, 1, 30))
+	if err := <-interactiveDone; err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-backgroundDone:
+		t.Fatalf("the background call should give way to the interactive one, got %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// A wait ends with its context, and the background call goes on once no interactive call is left
+	interactive, cancel := context.WithCancel(ctx)
+	go func() { interactiveDone <- l.wait(interactive, "store") }()
+	waitForWaiting(t, l, 1)
+	advance(30 * time.Second)
+	cancel()
+	if err := <-interactiveDone; !errors.Is(err, context.Canceled) {
+		t.Errorf("the interactive wait should be canceled, got %v", err)
+	}
+	select {
+	case err := <-backgroundDone:
+		if err != nil {
+			t.Errorf("the background call should be sent, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the background call should be woken when the interactive one gives up")
+	}
+
+	if state := l.state(); state[0].Waiting != 0 || state[0].InFlight != 2 {
+		t.Errorf("unexpected state %+v", state)
+	}
+}
+
+func waitForWaiting(t *testing.T, l *rateLimiter, waiting int) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if state := l.state(); len(state) == 1 && state[0].Waiting == waiting {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d waiting calls, got %+v", waiting, l.state())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
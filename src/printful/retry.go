@@ -0,0 +1,161 @@
+package printful
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Retries allowed before the budget earns any
+const RETRY_BUDGET_RESERVE = 10
+
+// RetryPolicy tells how calls failing with a 5xx or a network error are sent again
+type RetryPolicy struct {
+	// Attempts of a call, the first one included
+	MaxAttempts int
+	// Delay before the first retry, doubled for each of the next ones up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Retries earned by each call sent, so that an unhealthy Printful isn't flooded with retries
+	Budget float64
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   250 * time.Millisecond,
+	MaxDelay:    5 * time.Second,
+	Budget:      0.1,
+}
+
+// backoff returns the delay before a retry, with jitter so that failed calls don't come back all at once
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	delay := p.MaxDelay
+	if retry < 30 && p.BaseDelay<<(retry-1) < p.MaxDelay {
+		delay = p.BaseDelay << (retry - 1)
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	// Equal jitter keeps at least half of the delay
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+type retryBudget struct {
+	tokens float64
+	mutex  sync.Mutex
+}
+
+func newRetryBudget() *retryBudget {
+	return &retryBudget{tokens: RETRY_BUDGET_RESERVE}
+}
+
+func (b *retryBudget) deposit(amount float64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.tokens += amount
+	if b.tokens > RETRY_BUDGET_RESERVE {
+		b.tokens = RETRY_BUDGET_RESERVE
+	}
+}
+
+func (b *retryBudget) withdraw() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (b *retryBudget) available() float64 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.tokens
+}
+
+type callOptions struct {
+	idempotent bool
+	// Sent as Idempotency-Key
+	idempotencyKey string
+	// Finds what a failed call did before it is sent again, NotFoundError when it did nothing
+	recover func(ctx context.Context) (*http.Response, error)
+}
+
+type callOption func(*callOptions)
+
+// idempotent allows a POST without side effects, such as a rate calculation, to be sent again
+func idempotent() callOption {
+	return func(o *callOptions) {
+		o.idempotent = true
+	}
+}
+
+// idempotencyKey allows a POST creating a resource to be retried: recover looks for the resource
+// a failed attempt may have created, the call is sent again only when it returns a NotFoundError
+func idempotencyKey(key string, recover func(ctx context.Context) (*http.Response, error)) callOption {
+	return func(o *callOptions) {
+		o.idempotencyKey = key
+		o.recover = recover
+	}
+}
+
+func isTransientStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryFailure waits before sending again a call which failed with err, the transient failure number retry.
+// It returns a response when the recovery of the call found what the failed attempt did,
+// and an error when the call must not be sent again.
+func (c *Client) retryFailure(ctx context.Context, call callOptions, retry int, err error) (*http.Response, error) {
+	policy := c.retry()
+	if ctx.Err() != nil || retry >= policy.MaxAttempts {
+		return nil, err
+	}
+
+	if !call.idempotent && call.recover == nil {
+		return nil, err
+	}
+
+	delay := policy.backoff(retry)
+	if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+		return nil, err
+	}
+
+	if !c.retryBudget.withdraw() {
+		return nil, err
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return nil, err
+	case <-timer.C:
+	}
+
+	if call.recover == nil {
+		return nil, nil
+	}
+
+	resp, recoverErr := call.recover(ctx)
+	if recoverErr == nil {
+		return resp, nil
+	}
+	if errors.As(recoverErr, &NotFoundError{}) {
+		return nil, nil
+	}
+
+	return nil, err
+}
@@ -0,0 +1,328 @@
+package printful
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"printfulapi/src/model"
+	"strconv"
+
+	printfulAPIModel "github.com/baldurstod/printful-api-model"
+	"github.com/baldurstod/printful-api-model/schemas"
+)
+
+type ListSyncProductsResponse struct {
+	Code   int                   `json:"code"`
+	Result []schemas.SyncProduct `json:"result"`
+	Paging model.Paging          `json:"paging"`
+}
+
+type SyncVariantResponse struct {
+	Code   int                 `json:"code"`
+	Result schemas.SyncVariant `json:"result"`
+}
+
+func syncProductPath(ref model.SyncProductReference) (string, error) {
+	if ref.ExternalID != "" {
+		return "/products/@" + url.PathEscape(ref.ExternalID), nil
+	}
+
+	if ref.SyncProductID > 0 {
+		return "/products/" + strconv.FormatInt(ref.SyncProductID, 10), nil
+	}
+
+	return "", ValidationError{Message: "sync_product_id or external_id is required"}
+}
+
+func syncVariantPath(ref model.SyncVariantReference) (string, error) {
+	if ref.ExternalID != "" {
+		return "/variants/@" + url.PathEscape(ref.ExternalID), nil
+	}
+
+	if ref.SyncVariantID > 0 {
+		return "/variants/" + strconv.FormatInt(ref.SyncVariantID, 10), nil
+	}
+
+	return "", ValidationError{Message: "sync_variant_id or external_id is required"}
+}
+
+func syncVariantBody(fields model.SyncVariantFields) map[string]interface{} {
+	body := map[string]interface{}{}
+	if fields.VariantID != 0 {
+		body["variant_id"] = fields.VariantID
+	}
+	if fields.ExternalVariantID != "" {
+		body["external_id"] = fields.ExternalVariantID
+	}
+	if fields.RetailPrice != nil {
+		body["retail_price"] = strconv.FormatFloat(*fields.RetailPrice, 'f', 2, 64)
+	}
+	if fields.IsIgnored != nil {
+		body["is_ignored"] = *fields.IsIgnored
+	}
+	if fields.Files != nil {
+		body["files"] = fields.Files
+	}
+	if fields.Options != nil {
+		body["options"] = fields.Options
+	}
+
+	return body
+}
+
+func (c *Client) ListSyncProducts(ctx context.Context, request model.ListSyncProductsRequest) ([]schemas.SyncProduct, *model.Paging, error) {
+	query := url.Values{}
+	if request.Search != "" {
+		query.Set("search", request.Search)
+	}
+	if request.Offset > 0 {
+		query.Set("offset", strconv.Itoa(request.Offset))
+	}
+	if request.Limit > 0 {
+		query.Set("limit", strconv.Itoa(request.Limit))
+	}
+
+	resp, err := c.fetch(ctx, "GET", PRINTFUL_STORE_API, "/products?"+query.Encode(), nil)
+	if err != nil {
+		slog.WarnContext(ctx, "printful call failed", "error", err)
+		return nil, nil, fmt.Errorf("unable to get printful response: <%w>", err)
+	}
+	defer resp.Body.Close()
+
+	response := ListSyncProductsResponse{}
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to decode printful response", "error", err)
+		return nil, nil, errors.New("unable to decode printful response")
+	}
+
+	return response.Result, &response.Paging, nil
+}
+
+func (c *Client) fetchSyncProduct(ctx context.Context, method string, path string, body map[string]interface{}) (*printfulAPIModel.SyncProductInfo, error) {
+	resp, err := c.fetch(ctx, method, PRINTFUL_STORE_API, path, body)
+	if err != nil {
+		slog.WarnContext(ctx, "printful call failed", "error", err)
+		return nil, fmt.Errorf("unable to get printful response: <%w>", err)
+	}
+	defer resp.Body.Close()
+
+	response := GetSyncProductResponse{}
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to decode printful response", "error", err)
+		return nil, errors.New("unable to decode printful response")
+	}
+
+	return &response.Result, nil
+}
+
+// ModifySyncProduct renames a sync product and / or swaps the design of one placement of all its variants
+func (c *Client) ModifySyncProduct(ctx context.Context, request model.ModifySyncProductRequest) (*printfulAPIModel.SyncProductInfo, error) {
+	path, err := syncProductPath(request.SyncProductReference)
+	if err != nil {
+		return nil, err
+	}
+
+	placement := request.Placement
+	if placement == "" {
+		placement = DEFAULT_PLACEMENT
+	}
+
+	var info *printfulAPIModel.SyncProductInfo
+	swapDesign := !isDesignSourceEmpty(request.DesignSource)
+	if swapDesign {
+		// Check the placement before uploading anything or renaming the product
+		info, err = c.GetSyncProduct(ctx, request.SyncProductReference)
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for _, v := range info.SyncVariants {
+			found = found || hasPlacementFile(v.Files, placement)
+		}
+		if !found {
+			return nil, ValidationError{Message: "no sync variant has a file for placement " + placement}
+		}
+	}
+
+	syncProduct := map[string]interface{}{}
+	if request.Name != "" {
+		syncProduct["name"] = request.Name
+	}
+	if request.IsIgnored != nil {
+		syncProduct["is_ignored"] = *request.IsIgnored
+	}
+
+	var imageURL string
+	if swapDesign {
+		design, err := c.uploadDesign(ctx, request.DesignSource)
+		if err != nil {
+			return nil, err
+		}
+		imageURL = design.URL
+		syncProduct["thumbnail"] = design.ThumbnailURL
+	}
+
+	// Leave sync_variants out: Printful would delete the variants missing from the list
+	body := map[string]interface{}{
+		"sync_product": syncProduct,
+	}
+
+	_, err = c.fetchSyncProduct(ctx, "PUT", path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if !swapDesign {
+		return c.GetSyncProduct(ctx, request.SyncProductReference)
+	}
+
+	// Variants without a file for the placement are left as they are
+	updated := []int64{}
+	for _, syncVariant := range info.SyncVariants {
+		if !hasPlacementFile(syncVariant.Files, placement) {
+			continue
+		}
+
+		variantPath, _ := syncVariantPath(model.SyncVariantReference{SyncVariantID: syncVariant.ID})
+		_, err = c.fetchSyncVariant(ctx, "PUT", variantPath, map[string]interface{}{
+			"files": replacePlacementFile(syncVariant.Files, placement, imageURL),
+		})
+		if err != nil {
+			return nil, PartialUpdateError{SyncVariantIDs: updated, Err: err}
+		}
+		updated = append(updated, syncVariant.ID)
+	}
+
+	return c.GetSyncProduct(ctx, request.SyncProductReference)
+}
+
+func hasPlacementFile(files []schemas.SyncVariantFile, placement string) bool {
+	for _, file := range files {
+		if file.Type == placement {
+			return true
+		}
+	}
+	return false
+}
+
+// replacePlacementFile returns the files of a sync variant with the one of placement pointing to imageURL.
+// The other files are referenced by their id so that Printful keeps them as they are, previews are
+// generated by Printful and left out.
+func replacePlacementFile(files []schemas.SyncVariantFile, placement string, imageURL string) []map[string]interface{} {
+	replaced := make([]map[string]interface{}, 0, len(files))
+	for _, file := range files {
+		switch {
+		case file.Type == "preview":
+			continue
+		case file.Type == placement:
+			f := map[string]interface{}{"type": file.Type, "url": imageURL}
+			if file.Options != nil {
+				f["options"] = file.Options
+			}
+			replaced = append(replaced, f)
+		default:
+			replaced = append(replaced, map[string]interface{}{"type": file.Type, "id": file.ID})
+		}
+	}
+
+	return replaced
+}
+
+// DeleteSyncProduct deletes a sync product and all of its sync variants
+func (c *Client) DeleteSyncProduct(ctx context.Context, ref model.SyncProductReference) (*printfulAPIModel.SyncProductInfo, error) {
+	path, err := syncProductPath(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.fetchSyncProduct(ctx, "DELETE", path, nil)
+}
+
+func (c *Client) fetchSyncVariant(ctx context.Context, method string, path string, body map[string]interface{}) (*schemas.SyncVariant, error) {
+	resp, err := c.fetch(ctx, method, PRINTFUL_STORE_API, path, body)
+	if err != nil {
+		slog.WarnContext(ctx, "printful call failed", "error", err)
+		return nil, fmt.Errorf("unable to get printful response: <%w>", err)
+	}
+	defer resp.Body.Close()
+
+	response := SyncVariantResponse{}
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to decode printful response", "error", err)
+		return nil, errors.New("unable to decode printful response")
+	}
+
+	return &response.Result, nil
+}
+
+func (c *Client) GetSyncVariant(ctx context.Context, ref model.SyncVariantReference) (*schemas.SyncVariant, error) {
+	path, err := syncVariantPath(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.fetchSyncVariant(ctx, "GET", path, nil)
+}
+
+// CreateSyncVariant adds a variant to a sync product. Without files, the design of the
+// existing variants is reused.
+func (c *Client) CreateSyncVariant(ctx context.Context, request model.CreateSyncVariantRequest) (*schemas.SyncVariant, error) {
+	path, err := syncProductPath(request.SyncProductReference)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.VariantID == 0 {
+		return nil, ValidationError{Message: "variant_id is required"}
+	}
+
+	if request.Files == nil {
+		info, err := c.GetSyncProduct(ctx, request.SyncProductReference)
+		if err != nil {
+			return nil, err
+		}
+		if len(info.SyncVariants) == 0 {
+			return nil, ValidationError{Message: "files are required"}
+		}
+
+		for _, file := range info.SyncVariants[0].Files {
+			if file.Type == "preview" {
+				continue
+			}
+			request.Files = append(request.Files, schemas.File{Type: file.Type, URL: file.URL, Options: file.Options})
+		}
+	}
+
+	return c.fetchSyncVariant(ctx, "POST", path+"/variants", syncVariantBody(request.SyncVariantFields))
+}
+
+func (c *Client) ModifySyncVariant(ctx context.Context, request model.ModifySyncVariantRequest) (*schemas.SyncVariant, error) {
+	path, err := syncVariantPath(request.SyncVariantReference)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.fetchSyncVariant(ctx, "PUT", path, syncVariantBody(request.SyncVariantFields))
+}
+
+func (c *Client) DeleteSyncVariant(ctx context.Context, ref model.SyncVariantReference) error {
+	path, err := syncVariantPath(ref)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.fetch(ctx, "DELETE", PRINTFUL_STORE_API, path, nil)
+	if err != nil {
+		slog.WarnContext(ctx, "printful call failed", "error", err)
+		return fmt.Errorf("unable to get printful response: <%w>", err)
+	}
+	resp.Body.Close()
+
+	return nil
+}
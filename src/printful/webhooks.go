@@ -0,0 +1,77 @@
+package printful
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"printfulapi/src/model"
+)
+
+type WebhookInfoResponse struct {
+	Code   int               `json:"code"`
+	Result model.WebhookInfo `json:"result"`
+}
+
+func (c *Client) fetchWebhooks(ctx context.Context, method string, body map[string]interface{}) (*model.WebhookInfo, error) {
+	resp, err := c.fetch(ctx, method, PRINTFUL_WEBHOOKS_API, "", body)
+	if err != nil {
+		slog.WarnContext(ctx, "printful call failed", "error", err)
+		return nil, fmt.Errorf("unable to get printful response: <%w>", err)
+	}
+	defer resp.Body.Close()
+
+	response := WebhookInfoResponse{}
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to decode printful response", "error", err)
+		return nil, errors.New("unable to decode printful response")
+	}
+
+	// Don't hand the shared secret back to callers
+	if u, err := url.Parse(response.Result.URL); err == nil && u.Query().Has("secret") {
+		query := u.Query()
+		query.Del("secret")
+		u.RawQuery = query.Encode()
+		response.Result.URL = u.String()
+	}
+
+	return &response.Result, nil
+}
+
+func (c *Client) GetWebhooks(ctx context.Context) (*model.WebhookInfo, error) {
+	return c.fetchWebhooks(ctx, "GET", nil)
+}
+
+// SetWebhooks points the store webhooks to request.URL, adding the shared secret to the URL.
+// Every supported event type is enabled when none is given.
+func (c *Client) SetWebhooks(ctx context.Context, request model.SetWebhooksRequest) (*model.WebhookInfo, error) {
+	u, err := url.Parse(request.URL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, ValidationError{Message: "invalid webhook url"}
+	}
+
+	if c.config.WebhookSecret != "" {
+		query := u.Query()
+		query.Set("secret", c.config.WebhookSecret)
+		u.RawQuery = query.Encode()
+	}
+
+	types := request.Types
+	if len(types) == 0 {
+		types = model.WebhookEventTypes
+	}
+
+	body := map[string]interface{}{
+		"url":   u.String(),
+		"types": types,
+	}
+
+	return c.fetchWebhooks(ctx, "POST", body)
+}
+
+func (c *Client) DisableWebhooks(ctx context.Context) (*model.WebhookInfo, error) {
+	return c.fetchWebhooks(ctx, "DELETE", nil)
+}
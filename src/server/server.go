@@ -1,9 +1,15 @@
 package server
 
 import (
-	"log"
+	"context"
+	"log/slog"
+	"net/http"
 	"printfulapi/src/api"
 	"printfulapi/src/config"
+	"printfulapi/src/logging"
+	"printfulapi/src/metrics"
+	"printfulapi/src/model"
+	"printfulapi/src/webhooks"
 	"strconv"
 	"time"
 
@@ -13,30 +19,64 @@ import (
 
 var ReleaseMode = "true"
 
-func StartServer(config config.HTTP) {
-	engine := initEngine()
+// Time given to the requests in flight, the workers and the databases to finish when the configuration doesn't set one
+const DEFAULT_SHUTDOWN_TIMEOUT = 30 * time.Second
 
-	log.Printf("Listening on port %d\n", config.Port)
-	err := engine.RunTLS(":"+strconv.Itoa(config.Port), config.HttpsCertFile, config.HttpsKeyFile)
-	log.Fatal(err)
+type Server struct {
+	config config.HTTP
+	http   *http.Server
 }
 
-func initEngine() *gin.Engine {
+func NewServer(config config.HTTP, handler *api.Handler, auth *api.Authenticator, receiver *webhooks.Receiver, health *api.Health) *Server {
+	return &Server{
+		config: config,
+		http: &http.Server{
+			Addr:    ":" + strconv.Itoa(config.Port),
+			Handler: initEngine(handler, auth, receiver, health),
+		},
+	}
+}
+
+// Start serves until Shutdown is called, it then returns http.ErrServerClosed
+func (s *Server) Start() error {
+	slog.Info("listening", "port", s.config.Port)
+	return s.http.ListenAndServeTLS(s.config.HttpsCertFile, s.config.HttpsKeyFile)
+}
+
+// Shutdown stops accepting requests and waits for the requests in flight until ctx ends, they are then cut
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.http.Shutdown(ctx)
+	if err != nil {
+		s.http.Close()
+	}
+
+	return err
+}
+
+func initEngine(handler *api.Handler, auth *api.Authenticator, receiver *webhooks.Receiver, health *api.Health) *gin.Engine {
 	if ReleaseMode == "true" {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
-	r := gin.Default()
+	r := gin.New()
+	r.Use(logging.Middleware(), gin.Recovery())
 	r.SetTrustedProxies(nil)
 
 	r.Use(cors.New(cors.Config{
-		AllowMethods:    []string{"POST", "OPTIONS"},
-		AllowHeaders:    []string{"Origin", "Content-Length", "Content-Type", "Request-Id"},
-		AllowAllOrigins: true,
+		AllowMethods:    []string{"GET", "POST", "OPTIONS"},
+		AllowHeaders:    []string{"Origin", "Content-Length", "Content-Type", logging.REQUEST_ID_HEADER, api.API_KEY_HEADER},
+		ExposeHeaders:   []string{logging.REQUEST_ID_HEADER},
+		AllowOriginFunc: auth.AllowOrigin,
 		MaxAge:          12 * time.Hour,
 	}))
 
-	r.POST("/api", api.ApiHandler)
+	r.POST("/api", auth.Middleware(), handler.ApiHandler)
+	r.GET("/images/:filename", api.ImageHandler)
+	r.POST("/webhooks/printful", receiver.WebhookHandler)
+	r.GET("/healthz", health.LiveHandler)
+	r.GET("/readyz", health.ReadyHandler)
+	// The metrics tell the traffic and the Printful usage of the server, they are for the admins only
+	r.GET("/metrics", auth.Middleware(), api.RequireScope(model.SCOPE_ADMIN), gin.WrapH(metrics.Handler()))
 
 	return r
 }
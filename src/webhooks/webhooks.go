@@ -0,0 +1,112 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"printfulapi/src/logging"
+	"printfulapi/src/model"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EventStore keeps a log of the received events
+type EventStore interface {
+	InsertWebhookEvent(ctx context.Context, event *model.WebhookEvent) error
+}
+
+type HandlerFunc func(event *model.WebhookEvent) error
+
+type Receiver struct {
+	secret   string
+	store    EventStore
+	handlers map[string][]HandlerFunc
+	mutex    sync.RWMutex
+	// Handlers still running in the background
+	running sync.WaitGroup
+}
+
+func NewReceiver(secret string, store EventStore) *Receiver {
+	return &Receiver{
+		secret:   secret,
+		store:    store,
+		handlers: make(map[string][]HandlerFunc),
+	}
+}
+
+// Register adds a handler run for every received event of type eventType
+func (r *Receiver) Register(eventType string, handler HandlerFunc) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.handlers[eventType] = append(r.handlers[eventType], handler)
+}
+
+func (r *Receiver) WebhookHandler(c *gin.Context) {
+	if r.secret == "" {
+		slog.Warn("webhook received but no webhook secret is configured")
+		c.Status(http.StatusServiceUnavailable)
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(c.Query("secret")), []byte(r.secret)) != 1 {
+		c.Status(http.StatusUnauthorized)
+		return
+	}
+
+	event := model.WebhookEvent{}
+	if err := c.ShouldBindJSON(&event); err != nil || event.Type == "" {
+		slog.InfoContext(c.Request.Context(), "invalid webhook event", "error", err)
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	event.Received = time.Now().Unix()
+
+	if err := r.store.InsertWebhookEvent(c.Request.Context(), &event); err != nil {
+		// Let Printful retry later
+		slog.ErrorContext(c.Request.Context(), "unable to store webhook event", "type", event.Type, "error", err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	r.mutex.RLock()
+	handlers := r.handlers[event.Type]
+	r.mutex.RUnlock()
+
+	if len(handlers) == 0 {
+		slog.InfoContext(c.Request.Context(), "no handler for webhook event", "type", event.Type)
+	}
+
+	// Printful expects a quick answer, handlers run in the background, keeping the request id in their logs
+	ctx := logging.WithRequestID(context.Background(), logging.RequestID(c.Request.Context()))
+	r.running.Add(1)
+	go func() {
+		defer r.running.Done()
+		for _, handler := range handlers {
+			if err := handler(&event); err != nil {
+				slog.ErrorContext(ctx, "webhook handler failed", "type", event.Type, "error", err)
+			}
+		}
+	}()
+
+	c.Status(http.StatusOK)
+}
+
+// Wait waits for the handlers still running until ctx ends, once the server stopped receiving events
+func (r *Receiver) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		r.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,120 @@
+package webhooks
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"printfulapi/src/model"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type memoryStore struct {
+	events []model.WebhookEvent
+}
+
+func (s *memoryStore) InsertWebhookEvent(ctx context.Context, event *model.WebhookEvent) error {
+	s.events = append(s.events, *event)
+	return nil
+}
+
+func post(receiver *Receiver, query string, body string) int {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.POST("/webhooks/printful", receiver.WebhookHandler)
+
+	req := httptest.NewRequest("POST", "/webhooks/printful"+query, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+
+	return w.Code
+}
+
+func TestWebhookHandler(t *testing.T) {
+	store := &memoryStore{}
+	receiver := NewReceiver("s3cr3t", store)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	var shipped *model.WebhookEvent
+	receiver.Register(model.WEBHOOK_PACKAGE_SHIPPED, func(event *model.WebhookEvent) error {
+		shipped = event
+		wg.Done()
+		return nil
+	})
+
+	event := `{"type":"package_shipped","created":1622456737,"retries":0,"store":12,"data":{"shipment":{"id":10,"carrier":"USPS"},"order":{"id":13}}}`
+
+	if code := post(receiver, "", event); code != http.StatusUnauthorized {
+		t.Errorf("missing secret: expected 401, got %d", code)
+	}
+	if code := post(receiver, "?secret=wrong", event); code != http.StatusUnauthorized {
+		t.Errorf("wrong secret: expected 401, got %d", code)
+	}
+	if code := post(receiver, "?secret=s3cr3t", "{"); code != http.StatusBadRequest {
+		t.Errorf("invalid body: expected 400, got %d", code)
+	}
+	if len(store.events) != 0 {
+		t.Fatalf("rejected events should not be stored, got %d", len(store.events))
+	}
+
+	if code := post(receiver, "?secret=s3cr3t", event); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if len(store.events) != 1 || store.events[0].Store != 12 || store.events[0].Received == 0 {
+		t.Errorf("unexpected stored events %+v", store.events)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("handler was not called")
+	}
+	if shipped.Type != model.WEBHOOK_PACKAGE_SHIPPED || shipped.Data["order"] == nil {
+		t.Errorf("unexpected event %+v", shipped)
+	}
+}
+
+func TestWebhookHandlerWait(t *testing.T) {
+	receiver := NewReceiver("s3cr3t", &memoryStore{})
+
+	release := make(chan struct{})
+	receiver.Register(model.WEBHOOK_PACKAGE_SHIPPED, func(event *model.WebhookEvent) error {
+		<-release
+		return nil
+	})
+
+	if code := post(receiver, "?secret=s3cr3t", `{"type":"package_shipped"}`); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := receiver.Wait(ctx); err == nil {
+		t.Error("Wait should give up on a handler still running")
+	}
+
+	close(release)
+	if err := receiver.Wait(context.Background()); err != nil {
+		t.Errorf("Wait should return once the handlers end, got %v", err)
+	}
+}
+
+func TestWebhookHandlerWithoutSecret(t *testing.T) {
+	store := &memoryStore{}
+	receiver := NewReceiver("", store)
+
+	if code := post(receiver, "?secret=", `{"type":"stock_updated"}`); code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503, got %d", code)
+	}
+}